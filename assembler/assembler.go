@@ -1,10 +1,35 @@
 package assembler
 
-import "io"
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+)
 
 type Assembler struct {
-	reader io.Reader
-	writer io.Writer
+	// Filename is used for the positions of diagnostics
+	Filename string
+	// Recover makes WriteBinaryCode report all errors of the program instead of the first one
+	Recover bool
+	// MaxErrors keeps the first errors of the program in recover mode, and the rest are
+	// reported as too many errors. 0 means no limit.
+	MaxErrors int
+	// Diagnostics has all errors and warnings found by WriteBinaryCode
+	Diagnostics Diagnostics
+	// Format is the encoding of machine code. HackFormat is used when it is nil.
+	Format Format
+	// Listing receives the listing of the program when it is not nil: ROM address, machine code
+	// and source line of every source line, followed by the symbol table.
+	Listing io.Writer
+	// Parser is the parser of the last WriteBinaryCode. It has commands and symbols of the program.
+	Parser *Parser
+	// FS has the files of .include. Included files can not be read when it is nil.
+	FS fs.FS
+	// IncludePath is the directories in FS where .include searches files after the directory of the including file
+	IncludePath []string
+	reader      io.Reader
+	writer      io.Writer
 }
 
 func New(reader io.Reader, writer io.Writer) *Assembler {
@@ -14,22 +39,90 @@ func New(reader io.Reader, writer io.Writer) *Assembler {
 	}
 }
 
-func (a *Assembler) WriteBinaryCode() {
-	parser := NewParser(a.reader)
+// NewFS returns *Assembler reading the program from file name of fsys.
+// Files of .include are read from fsys too.
+func NewFS(fsys fs.FS, name string, writer io.Writer) *Assembler {
+	return &Assembler{
+		Filename: name,
+		FS:       fsys,
+		writer:   writer,
+	}
+}
 
-	for parser.Advance() {
-		command := parser.ParseOne()
-		if command.IsNil() {
-			continue
+// WriteBinaryCode assembles the whole program and writes the machine code
+// of A and C commands in Format.
+// Labels and variables are resolved by Parser.Parse before any code is written.
+// It returns a *Diagnostic with the failing position when the program can not be
+// assembled, or the error of the writer. In recover mode, all errors are returned
+// as Diagnostics. Nothing is written when there is an error. The listing is written after the
+// machine code if Listing is set.
+func (a *Assembler) WriteBinaryCode() error {
+	reader := a.reader
+	if reader == nil {
+		if a.FS == nil {
+			return errors.New("no program to assemble: reader and FS are nil")
 		}
-		codebits := NewCodeBits(command)
-		bits, err := codebits.Generate()
+		file, err := a.FS.Open(a.Filename)
 		if err != nil {
-			panic(err.Error())
+			return err
 		}
-		if _, err = a.writer.Write([]byte(bits)); err != nil {
-			panic(err.Error())
+		defer file.Close()
+		reader = file
+	}
+	// the listing shows source lines
+	source := new(bytes.Buffer)
+	if a.Listing != nil {
+		reader = io.TeeReader(reader, source)
+	}
+	parser := NewParser(reader)
+	parser.Filename = a.Filename
+	parser.Recover = a.Recover
+	parser.FS = a.FS
+	parser.IncludePath = a.IncludePath
+	a.Parser = parser
+	defer func() {
+		a.Diagnostics = parser.Diagnostics
+	}()
+
+	if err := parser.Parse(); err != nil && parser.stopped {
+		return err
+	}
+
+	var words []uint16
+	for _, command := range parser.Commands {
+		// labels only mark ROM addresses and constants only have values. They have no binary code.
+		if command.CommandType != ACommand && command.CommandType != CCommand {
+			continue
 		}
-		a.writer.Write([]byte("\n"))
+		word, err := EncodeCommand(command)
+		if err != nil {
+			diagnostic, ok := err.(*Diagnostic)
+			if !ok {
+				diagnostic = newDiagnostic(command.Pos, "%s", err)
+			}
+			if err := parser.report(diagnostic); err != nil {
+				return err
+			}
+			continue
+		}
+		words = append(words, word)
+	}
+
+	// errors are cut after encoding errors are found, so that the first errors are kept
+	parser.MaxErrors = a.MaxErrors
+	if err := parser.finish(); err != nil {
+		return err
+	}
+
+	format := a.Format
+	if format == nil {
+		format = HackFormat
+	}
+	if err := format.Write(a.writer, words); err != nil {
+		return err
+	}
+	if a.Listing != nil {
+		return writeListing(a.Listing, source.String(), parser, words)
 	}
+	return nil
 }
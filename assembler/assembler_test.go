@@ -2,6 +2,9 @@ package assembler
 
 import (
 	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -15,9 +18,11 @@ M=M-1;JMP
 `)
 	writer := new(bytes.Buffer)
 	assembler := New(reader, writer)
-	assembler.WriteBinaryCode()
+	if err := assembler.WriteBinaryCode(); err != nil {
+		t.Fatalf("assembler.WriteBinaryCode() results in error: %s", err)
+	}
 
-	wanted := `1000000000001110
+	wanted := `0000000000001110
 1110001100000001
 1110000010010000
 1111110010001111
@@ -32,3 +37,191 @@ but got:
 `, wanted, got)
 	}
 }
+
+func TestAssembler_WriteBinaryCode_symbols(t *testing.T) {
+	reader := strings.NewReader(
+		`@R0
+D=M
+@R1
+D=D-M
+@OUTPUT_FIRST
+D;JGT
+@R1
+D=M
+@OUTPUT_D
+0;JMP
+(OUTPUT_FIRST)
+@R0
+D=M
+(OUTPUT_D)
+@R2
+M=D
+@i
+M=1
+(INFINITE_LOOP)
+@INFINITE_LOOP
+0;JMP
+`)
+	writer := new(bytes.Buffer)
+	assembler := New(reader, writer)
+	if err := assembler.WriteBinaryCode(); err != nil {
+		t.Fatalf("assembler.WriteBinaryCode() results in error: %s", err)
+	}
+
+	wanted := `0000000000000000
+1111110000010000
+0000000000000001
+1111010011010000
+0000000000001010
+1110001100000001
+0000000000000001
+1111110000010000
+0000000000001100
+1110101010000111
+0000000000000000
+1111110000010000
+0000000000000010
+1110001100001000
+0000000000010000
+1110111111001000
+0000000000010000
+1110101010000111
+`
+	got := writer.String()
+	if got != wanted {
+		t.Errorf(`assembly code is not properly converted to binary code
+wanted:
+%s
+but got:
+%s
+`, wanted, got)
+	}
+}
+
+func TestAssembler_WriteBinaryCode_error(t *testing.T) {
+	tests := []struct {
+		code   string
+		wanted string
+	}{
+		{code: "@1\n  D=X\n", wanted: `Foo.asm:2:3: unknown comp "X"`},
+		{code: "@1\nAX=D\n", wanted: `Foo.asm:2:1: unknown dest "AX"`},
+		{code: "@1\n0;JJ\n", wanted: `Foo.asm:2:1: unknown jump "JJ"`},
+		{code: "@1\n(R0)\n", wanted: `Foo.asm:2:1: label "R0" conflicts with predefined symbol`},
+		{code: "@32768\n", wanted: "Foo.asm:1:1: A command value 32768 is greater than 32767"},
+	}
+
+	for _, test := range tests {
+		writer := new(bytes.Buffer)
+		assembler := New(strings.NewReader(test.code), writer)
+		assembler.Filename = "Foo.asm"
+		err := assembler.WriteBinaryCode()
+		if err == nil {
+			t.Errorf("assembler.WriteBinaryCode() should return error for %q", test.code)
+			continue
+		}
+		if _, ok := err.(*Diagnostic); !ok {
+			t.Errorf("assembler.WriteBinaryCode() error type = %T, want *Diagnostic", err)
+		}
+		if err.Error() != test.wanted {
+			t.Errorf("assembler.WriteBinaryCode() error = %q, want %q", err.Error(), test.wanted)
+		}
+	}
+}
+
+func TestAssembler_WriteBinaryCode_recover(t *testing.T) {
+	code := `@1
+(R0)
+D=X
+@40000
+0;JJ
+`
+	tests := []struct {
+		code      string
+		maxErrors int
+		wanted    string
+	}{
+		{maxErrors: 0, wanted: `Foo.asm:2:1: label "R0" conflicts with predefined symbol
+Foo.asm:3:1: unknown comp "X"
+Foo.asm:4:1: A command value 40000 is greater than 32767
+Foo.asm:5:1: unknown jump "JJ"`},
+		{maxErrors: 2, wanted: `Foo.asm:2:1: label "R0" conflicts with predefined symbol
+Foo.asm:3:1: unknown comp "X"
+Foo.asm:3:1: too many errors`},
+		{maxErrors: 4, wanted: `Foo.asm:2:1: label "R0" conflicts with predefined symbol
+Foo.asm:3:1: unknown comp "X"
+Foo.asm:4:1: A command value 40000 is greater than 32767
+Foo.asm:5:1: unknown jump "JJ"`},
+		// encoding errors are before parsing errors in the file
+		{code: "D=X\nD=Y\n(A)\n(A)\n@1x\n", maxErrors: 2, wanted: `Foo.asm:1:1: unknown comp "X"
+Foo.asm:2:1: unknown comp "Y"
+Foo.asm:2:1: too many errors`},
+	}
+
+	for _, test := range tests {
+		if test.code == "" {
+			test.code = code
+		}
+		writer := new(bytes.Buffer)
+		assembler := New(strings.NewReader(test.code), writer)
+		assembler.Filename = "Foo.asm"
+		assembler.Recover = true
+		assembler.MaxErrors = test.maxErrors
+
+		err := assembler.WriteBinaryCode()
+		if _, ok := err.(Diagnostics); !ok {
+			t.Errorf("assembler.WriteBinaryCode() error type = %T, want Diagnostics", err)
+			continue
+		}
+		if err.Error() != test.wanted {
+			t.Errorf("assembler.WriteBinaryCode() error =\n%s\nwant\n%s", err.Error(), test.wanted)
+		}
+		if writer.Len() != 0 {
+			t.Errorf("assembler.WriteBinaryCode() should not write code with errors, got %q", writer.String())
+		}
+	}
+}
+
+// TestAssembler_WriteBinaryCode_programs assembles Nand2Tetris programs in testdata
+// and compares them with .hack files of the reference assembler.
+func TestAssembler_WriteBinaryCode_programs(t *testing.T) {
+	for _, name := range []string{"Add", "Max", "Rect", "Pong"} {
+		file, err := os.Open(filepath.Join("testdata", name+".asm"))
+		if os.IsNotExist(err) && name == "Pong" {
+			// Pong.asm and Pong.hack of Nand2Tetris project 6 are copied to testdata to test the largest program
+			t.Logf("testdata/Pong.asm not found, Pong is not tested")
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		wanted, err := ioutil.ReadFile(filepath.Join("testdata", name+".hack"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		writer := new(bytes.Buffer)
+		assembler := New(file, writer)
+		assembler.Filename = name + ".asm"
+		if err := assembler.WriteBinaryCode(); err != nil {
+			t.Errorf("%s.asm: assembler.WriteBinaryCode() results in error: %s", name, err)
+		}
+		file.Close()
+
+		if got := writer.String(); got != string(wanted) {
+			t.Errorf("%s.asm is not properly converted to binary code\nwanted:\n%s\nbut got:\n%s", name, wanted, got)
+		}
+	}
+}
+
+func TestAssembler_WriteBinaryCode_format(t *testing.T) {
+	writer := new(bytes.Buffer)
+	assembler := New(strings.NewReader("@2\nD=A\n"), writer)
+	assembler.Format = ReadmemhFormat
+	if err := assembler.WriteBinaryCode(); err != nil {
+		t.Fatalf("assembler.WriteBinaryCode() results in error: %s", err)
+	}
+
+	if got := writer.String(); got != "0002\nec10\n" {
+		t.Errorf("assembler.WriteBinaryCode() = %q, want %q", got, "0002\nec10\n")
+	}
+}
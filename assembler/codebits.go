@@ -3,116 +3,215 @@ package assembler
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 )
 
 // compToBits maps comp operation to bits.
-// value is 7 bits string: a c1 c2 c3 c4 c5 c6
-var compToBits = map[string] string {
-	"0": "0101010",
-	"1": "011111",
-	"-1": "0111010",
-	"D": "0001100",
-	"A": "0110000",
-	"!D": "0001101",
-	"!A": "0110001",
-	"-D": "0001111",
-	"-A": "0110011",
-	"D+1": "0011111",
-	"A+1": "0110111",
-	"D-1": "0001110",
-	"A-1": "0110010",
-	"D+A": "0000010",
-	"D-A": "0000010",
-	"A-D": "0000111",
-	"D&A" : "0000000",
-	"D|A": "0010101",
-	"M": "1110000",
-	"!M": "1110001",
-	"-M": "1110011",
-	"M+1": "1110111",
-	"M-1": "1110010",
-	"D+M": "1000010",
-	"D-M": "1010011",
-	"M-D": "1000111",
-	"D&M": "1000000",
-	"D|M": "1010101",
+// value is 7 bits: a c1 c2 c3 c4 c5 c6
+var compToBits = map[string]uint16{
+	"0":   0b0101010,
+	"1":   0b0111111,
+	"-1":  0b0111010,
+	"D":   0b0001100,
+	"A":   0b0110000,
+	"!D":  0b0001101,
+	"!A":  0b0110001,
+	"-D":  0b0001111,
+	"-A":  0b0110011,
+	"D+1": 0b0011111,
+	"A+1": 0b0110111,
+	"D-1": 0b0001110,
+	"A-1": 0b0110010,
+	"D+A": 0b0000010,
+	"D-A": 0b0010011,
+	"A-D": 0b0000111,
+	"D&A": 0b0000000,
+	"D|A": 0b0010101,
+	"M":   0b1110000,
+	"!M":  0b1110001,
+	"-M":  0b1110011,
+	"M+1": 0b1110111,
+	"M-1": 0b1110010,
+	"D+M": 0b1000010,
+	"D-M": 0b1010011,
+	"M-D": 0b1000111,
+	"D&M": 0b1000000,
+	"D|M": 0b1010101,
 }
 
 // destToBits maps dest operation to bits.
-// value is 3 bits string: d1 d2 d3
-var destToBits = map[string]string {
-	"": "000",
-	"M": "001",
-	"D": "010",
-	"MD": "011",
-	"A": "100",
-	"AM": "101",
-	"AD": "110",
-	"AMD": "111",
+// value is 3 bits: d1 d2 d3
+var destToBits = map[string]uint16{
+	"":    0b000,
+	"M":   0b001,
+	"D":   0b010,
+	"MD":  0b011,
+	"A":   0b100,
+	"AM":  0b101,
+	"AD":  0b110,
+	"AMD": 0b111,
 }
 
 // jumpToBits maps jump operation to bits.
-// value is 3 bits string: j1 j2 j3
-var jumpToBits = map[string]string {
-	"": "000",
-	"JGT": "001",
-	"JEQ": "010",
-	"JGE": "011",
-	"JLT": "100",
-	"JNE": "101",
-	"JLE": "110",
-	"JMP": "111",
+// value is 3 bits: j1 j2 j3
+var jumpToBits = map[string]uint16{
+	"":    0b000,
+	"JGT": 0b001,
+	"JEQ": 0b010,
+	"JGE": 0b011,
+	"JLT": 0b100,
+	"JNE": 0b101,
+	"JLE": 0b110,
+	"JMP": 0b111,
 }
 
-type CodeBits struct {
-	command Command
+// maxAValue is the greatest value of A command which has 15 bits for value
+const maxAValue = 1<<15 - 1
+
+// EncodeCommand encodes A or C command to a hack machine code word.
+// A command is encoded from SymbolInt which is resolved by Parser.Parse.
+// It returns *Diagnostic as error when the command can not be encoded.
+func EncodeCommand(command Command) (uint16, error) {
+	switch command.CommandType {
+	case ACommand:
+		return encodeACommand(command)
+	case CCommand:
+		return encodeCCommand(command)
+	default:
+		return 0, newDiagnostic(command.Pos, "unknown command type %q", command.CommandType)
+	}
 }
 
-func NewCodeBits(command Command) *CodeBits {
-	return &CodeBits{
-		command: command,
+// encodeACommand encodes A command as 0 v v v v v v v v v v v v v v v
+func encodeACommand(command Command) (uint16, error) {
+	if command.SymbolInt > maxAValue {
+		return 0, newDiagnostic(command.Pos, "A command value %d is greater than %d", command.SymbolInt, maxAValue)
 	}
+	return command.SymbolInt, nil
 }
 
-// Generate generates hack assembly bits from command
-func (b *CodeBits) Generate() (string, error){
-	switch b.command.CommandType {
-	case ACommand:
-		return b.fromACommand()
-	case CCommand:
-		return b.fromCCommand()
-	default:
-		return "", errors.New(fmt.Sprintf("%s is not proper command type", b.command.CommandType))
+// encodeCCommand encodes C command as 1 1 1 a c1 c2 c3 c4 c5 c6 d1 d2 d3 j1 j2 j3
+func encodeCCommand(command Command) (uint16, error) {
+	compBits, ok := compToBits[command.Comp]
+	if !ok {
+		return 0, newDiagnostic(command.Pos, "unknown comp %q", command.Comp)
 	}
+
+	destBits, ok := destToBits[command.Dest]
+	if !ok {
+		return 0, newDiagnostic(command.Pos, "unknown dest %q", command.Dest)
+	}
+
+	jumpBits, ok := jumpToBits[command.Jump]
+	if !ok {
+		return 0, newDiagnostic(command.Pos, "unknown jump %q", command.Jump)
+	}
+
+	return 0b111<<13 | compBits<<6 | destBits<<3 | jumpBits, nil
 }
 
-func (b *CodeBits) fromACommand() (string, error) {
-	symbol := b.command.Symbol
+// CompMnemonics returns all comp operations in sorted order, e.g. "D+1".
+func CompMnemonics() []string {
+	return mnemonics(compToBits)
+}
 
-	converter, err := NewIntToBitsConverter(symbol, 15, true)
+// DestMnemonics returns all dest operations in sorted order, e.g. "AM". Empty dest is not included.
+func DestMnemonics() []string {
+	return mnemonics(destToBits)
+}
 
-	if err != nil {
-		return "", err
+// JumpMnemonics returns all jump operations in sorted order, e.g. "JGT". Empty jump is not included.
+func JumpMnemonics() []string {
+	return mnemonics(jumpToBits)
+}
+
+func mnemonics(toBits map[string]uint16) []string {
+	var names []string
+	for name := range toBits {
+		if name != "" {
+			names = append(names, name)
+		}
 	}
+	sort.Strings(names)
+	return names
+}
+
+// bitsToComp, bitsToDest and bitsToJump are reverse maps of compToBits, destToBits and jumpToBits
+var (
+	bitsToComp = reverseBits(compToBits)
+	bitsToDest = reverseBits(destToBits)
+	bitsToJump = reverseBits(jumpToBits)
+)
 
-	return "1" + converter.ToBits(), nil
+func reverseBits(toBits map[string]uint16) map[uint16]string {
+	reversed := make(map[uint16]string, len(toBits))
+	for mnemonic, bits := range toBits {
+		reversed[bits] = mnemonic
+	}
+	return reversed
 }
 
-func (b *CodeBits) fromCCommand() (string, error) {
-	compBits, ok := compToBits[b.command.Comp]
-	if !ok {
-		return "", errors.New(fmt.Sprintf("%s is not proper comp", b.command.Comp))
+// DecodeCommand decodes a hack machine code word to A or C command.
+// It returns error when comp bits of C command is not a valid comp operation,
+// or the unused bits of C command are not 11.
+func DecodeCommand(word uint16) (Command, error) {
+	// A command: 0 v v v v v v v v v v v v v v v
+	if word>>15 == 0 {
+		return Command{
+			CommandType: ACommand,
+			Symbol:      strconv.FormatUint(uint64(word), 10),
+			SymbolInt:   word,
+		}, nil
 	}
 
-	destBits, ok := destToBits[b.command.Dest]
+	// C command: 1 1 1 a c1 c2 c3 c4 c5 c6 d1 d2 d3 j1 j2 j3
+	if word>>13 != 0b111 {
+		return Command{}, errors.New(fmt.Sprintf("%016b should start with 111", word))
+	}
+	compBits := word >> 6 & 0b1111111
+	comp, ok := bitsToComp[compBits]
 	if !ok {
-		return "", errors.New(fmt.Sprintf("%s is not proper dest", b.command.Dest))
+		return Command{}, errors.New(fmt.Sprintf("%016b has unknown comp bits %07b", word, compBits))
 	}
+	return Command{
+		CommandType: CCommand,
+		Dest:        bitsToDest[word>>3&0b111],
+		Comp:        comp,
+		Jump:        bitsToJump[word&0b111],
+	}, nil
+}
 
-	jumpBits, ok := jumpToBits[b.command.Jump]
-	if !ok {
-		return "", errors.New(fmt.Sprintf("%s is not proper jump", b.command.Jump))
+// CodeBits generates the text of hack machine code as in .hack files.
+type CodeBits struct {
+	command Command
+}
+
+func NewCodeBits(command Command) *CodeBits {
+	return &CodeBits{
+		command: command,
 	}
+}
+
+// Generate generates hack assembly bits from command
+func (b *CodeBits) Generate() (string, error) {
+	return wordToBits(EncodeCommand(b.command))
+}
+
+// fromACommand generates bits from SymbolInt which is resolved by Parser.Parse
+// for number, label and variable symbols.
+func (b *CodeBits) fromACommand() (string, error) {
+	return wordToBits(encodeACommand(b.command))
+}
+
+func (b *CodeBits) fromCCommand() (string, error) {
+	return wordToBits(encodeCCommand(b.command))
+}
 
-	return "111" + compBits + destBits + jumpBits, nil
+// wordToBits formats word as 16 characters of 0 and 1.
+func wordToBits(word uint16, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%016b", word), nil
 }
@@ -8,11 +8,11 @@ func TestCodeBits_Generate(t *testing.T) {
 		wanted string
 		isErr bool
 	}{
-		{command: Command{CommandType: ACommand, Symbol: "abc"}, wanted: "", isErr: true},
-		{command: Command{CommandType: ACommand, Symbol: "-1"}, wanted: "", isErr: true},
-		{command: Command{CommandType: ACommand, Symbol: "32767"}, wanted: "1111111111111111", isErr: false},
-		{command: Command{CommandType: ACommand, Symbol: "0"}, wanted: "1000000000000000", isErr: false},
-		{command: Command{CommandType: ACommand, Symbol: "14"}, wanted: "1000000000001110", isErr: false},
+		{command: Command{CommandType: ACommand, Symbol: "32768", SymbolInt: 32768}, wanted: "", isErr: true},
+		{command: Command{CommandType: ACommand, Symbol: "32767", SymbolInt: 32767}, wanted: "0111111111111111", isErr: false},
+		{command: Command{CommandType: ACommand, Symbol: "0", SymbolInt: 0}, wanted: "0000000000000000", isErr: false},
+		{command: Command{CommandType: ACommand, Symbol: "14", SymbolInt: 14}, wanted: "0000000000001110", isErr: false},
+		{command: Command{CommandType: ACommand, Symbol: "LOOP", SymbolInt: 14}, wanted: "0000000000001110", isErr: false},
 		{
 			command: Command{CommandType: CCommand, Comp: "A+1", Dest: "MD", Jump: ""},
 			wanted: "1110110111011000", isErr: false,
@@ -21,6 +21,14 @@ func TestCodeBits_Generate(t *testing.T) {
 			command: Command{CommandType: CCommand, Comp: "0", Dest: "", Jump: "JMP"},
 			wanted: "1110101010000111", isErr: false,
 		},
+		{
+			command: Command{CommandType: CCommand, Comp: "1", Dest: "M", Jump: ""},
+			wanted: "1110111111001000", isErr: false,
+		},
+		{
+			command: Command{CommandType: CCommand, Comp: "D-A", Dest: "D", Jump: ""},
+			wanted: "1110010011010000", isErr: false,
+		},
 		{
 			command: Command{CommandType: CCommand, Comp: "K+1", Dest: "MD", Jump: ""},
 			wanted: "", isErr: true,
@@ -69,11 +77,11 @@ func TestCodeBits_fromACommand(t *testing.T) {
 		wanted string
 		isErr bool
 	}{
-		{command: Command{CommandType: ACommand, Symbol: "abc"}, wanted: "", isErr: true},
-		{command: Command{CommandType: ACommand, Symbol: "-1"}, wanted: "", isErr: true},
-		{command: Command{CommandType: ACommand, Symbol: "32767"}, wanted: "1111111111111111", isErr: false},
-		{command: Command{CommandType: ACommand, Symbol: "0"}, wanted: "1000000000000000", isErr: false},
-		{command: Command{CommandType: ACommand, Symbol: "14"}, wanted: "1000000000001110", isErr: false},
+		{command: Command{CommandType: ACommand, Symbol: "32768", SymbolInt: 32768}, wanted: "", isErr: true},
+		{command: Command{CommandType: ACommand, Symbol: "32767", SymbolInt: 32767}, wanted: "0111111111111111", isErr: false},
+		{command: Command{CommandType: ACommand, Symbol: "0", SymbolInt: 0}, wanted: "0000000000000000", isErr: false},
+		{command: Command{CommandType: ACommand, Symbol: "14", SymbolInt: 14}, wanted: "0000000000001110", isErr: false},
+		{command: Command{CommandType: ACommand, Symbol: "LOOP", SymbolInt: 14}, wanted: "0000000000001110", isErr: false},
 	}
 
 	for _, test := range tests {
@@ -114,6 +122,14 @@ func TestCodeBits_fromCCommand(t *testing.T) {
 			command: Command{CommandType: CCommand, Comp: "0", Dest: "", Jump: "JMP"},
 			wanted: "1110101010000111", isErr: false,
 		},
+		{
+			command: Command{CommandType: CCommand, Comp: "1", Dest: "M", Jump: ""},
+			wanted: "1110111111001000", isErr: false,
+		},
+		{
+			command: Command{CommandType: CCommand, Comp: "D-A", Dest: "D", Jump: ""},
+			wanted: "1110010011010000", isErr: false,
+		},
 		{
 			command: Command{CommandType: CCommand, Comp: "K+1", Dest: "MD", Jump: ""},
 			wanted: "", isErr: true,
@@ -151,3 +167,121 @@ func TestCodeBits_fromCCommand(t *testing.T) {
 		}
 	}
 }
+
+func TestEncodeCommand(t *testing.T) {
+	tests := []struct {
+		command Command
+		wanted uint16
+		isErr bool
+	}{
+		{command: Command{CommandType: ACommand, Symbol: "14", SymbolInt: 14}, wanted: 0x000e, isErr: false},
+		{command: Command{CommandType: ACommand, Symbol: "32767", SymbolInt: 32767}, wanted: 0x7fff, isErr: false},
+		{command: Command{CommandType: ACommand, Symbol: "32768", SymbolInt: 32768}, wanted: 0, isErr: true},
+		{command: Command{CommandType: CCommand, Comp: "D", Jump: "JGT"}, wanted: 0xe301, isErr: false},
+		{command: Command{CommandType: CCommand, Comp: "M-1", Dest: "AMD"}, wanted: 0xfcb8, isErr: false},
+		{command: Command{CommandType: CCommand, Comp: "K+1", Dest: "MD"}, wanted: 0, isErr: true},
+		{command: Command{CommandType: LCommand, Symbol: "LOOP"}, wanted: 0, isErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := EncodeCommand(test.command)
+		if test.isErr {
+			if err == nil {
+				t.Errorf("EncodeCommand(): error should not be nil with command %+v", test.command)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("EncodeCommand(): unexpected error '%s' with %+v", err.Error(), test.command)
+		} else if got != test.wanted {
+			t.Errorf("EncodeCommand() = %04x, but want %04x", got, test.wanted)
+		}
+	}
+}
+
+func TestDecodeCommand(t *testing.T) {
+	tests := []struct {
+		word   uint16
+		wanted Command
+		isErr  bool
+	}{
+		{word: 0x000e, wanted: Command{CommandType: ACommand, Symbol: "14", SymbolInt: 14}},
+		{word: 0x7fff, wanted: Command{CommandType: ACommand, Symbol: "32767", SymbolInt: 32767}},
+		{word: 0xe301, wanted: Command{CommandType: CCommand, Comp: "D", Jump: "JGT"}},
+		{word: 0xfcb8, wanted: Command{CommandType: CCommand, Comp: "M-1", Dest: "AMD"}},
+		{word: 0xea87, wanted: Command{CommandType: CCommand, Comp: "0", Jump: "JMP"}},
+		// comp bits 0000001 is not a comp operation
+		{word: 0xe040, isErr: true},
+		// unused bits should be 11
+		{word: 0x8301, isErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := DecodeCommand(test.word)
+		if test.isErr {
+			if err == nil {
+				t.Errorf("DecodeCommand(%016b): error should not be nil", test.word)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("DecodeCommand(%016b): unexpected error '%s'", test.word, err.Error())
+		} else if got != test.wanted {
+			t.Errorf("DecodeCommand(%016b) = %+v, but want %+v", test.word, got, test.wanted)
+		}
+	}
+
+	// every C command decodes to the command encoded to it
+	for comp := range compToBits {
+		for dest := range destToBits {
+			for jump := range jumpToBits {
+				command := Command{CommandType: CCommand, Dest: dest, Comp: comp, Jump: jump}
+				word, err := EncodeCommand(command)
+				if err != nil {
+					t.Fatalf("EncodeCommand(): unexpected error '%s' with %+v", err.Error(), command)
+				}
+				if got, err := DecodeCommand(word); err != nil || got != command {
+					t.Errorf("DecodeCommand(%016b) = %+v, %v, but want %+v", word, got, err, command)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkEncodeCommand(b *testing.B) {
+	commands := []Command{
+		{CommandType: ACommand, Symbol: "LOOP", SymbolInt: 14},
+		{CommandType: CCommand, Dest: "AM", Comp: "M+1"},
+		{CommandType: CCommand, Comp: "D", Jump: "JGT"},
+	}
+
+	for i := 0; i < b.N; i++ {
+		for _, command := range commands {
+			if _, err := EncodeCommand(command); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestMnemonics(t *testing.T) {
+	tests := []struct {
+		name      string
+		mnemonics []string
+		length    int
+	}{
+		{name: "comp", mnemonics: CompMnemonics(), length: 28},
+		{name: "dest", mnemonics: DestMnemonics(), length: 7},
+		{name: "jump", mnemonics: JumpMnemonics(), length: 7},
+	}
+	for _, test := range tests {
+		if len(test.mnemonics) != test.length {
+			t.Errorf("%s mnemonics = %v, want %d mnemonics", test.name, test.mnemonics, test.length)
+		}
+		for i := 1; i < len(test.mnemonics); i++ {
+			if test.mnemonics[i-1] >= test.mnemonics[i] {
+				t.Errorf("%s mnemonics = %v, should be sorted", test.name, test.mnemonics)
+			}
+		}
+	}
+}
@@ -6,6 +6,8 @@ const (
 	ACommand CommandType = "A"
 	CCommand CommandType = "C"
 	LCommand CommandType = "L"
+	// EquCommand defines a constant, e.g. ".equ SCREEN_WORDS 8192"
+	EquCommand CommandType = "EQU"
 )
 
 type Command struct {
@@ -15,6 +17,16 @@ type Command struct {
 	Dest string
 	Comp string
 	Jump string
+	// Pos is the position of the command in the source
+	Pos Position
+	// Text is the original source text of the command without surrounding spaces
+	Text string
+	// Value is the value of constant given by EquCommand, a decimal number or a symbol.
+	// SymbolInt is the resolved value after Parser.Parse.
+	Value string
+	// Origin is the position which the command is generated from, given by "//# source file:line"
+	// comment before the command, e.g. a line of .vm file. It is zero without the comment.
+	Origin Position
 }
 
 // IsNil determins Command struct has no data.
@@ -23,3 +35,25 @@ func (c Command) IsNil() bool {
 	return c.CommandType == "" && c.Symbol == "" &&
 		c.Dest == "" && c.Comp == "" && c.Jump == ""
 }
+
+// String returns the command in hack assembly. e.g. "@LOOP", "D=D+A;JGT", "(LOOP)", ".equ N 4"
+func (c Command) String() string {
+	switch c.CommandType {
+	case ACommand:
+		return "@" + c.Symbol
+	case LCommand:
+		return "(" + c.Symbol + ")"
+	case EquCommand:
+		return equDirective + " " + c.Symbol + " " + c.Value
+	case CCommand:
+		s := c.Comp
+		if c.Dest != "" {
+			s = c.Dest + "=" + s
+		}
+		if c.Jump != "" {
+			s += ";" + c.Jump
+		}
+		return s
+	}
+	return ""
+}
@@ -0,0 +1,24 @@
+package assembler
+
+import "testing"
+
+func TestCommand_String(t *testing.T) {
+	tests := []struct {
+		command Command
+		wanted  string
+	}{
+		{command: Command{CommandType: ACommand, Symbol: "LOOP", SymbolInt: 4}, wanted: "@LOOP"},
+		{command: Command{CommandType: LCommand, Symbol: "LOOP"}, wanted: "(LOOP)"},
+		{command: Command{CommandType: CCommand, Dest: "AM", Comp: "M+1"}, wanted: "AM=M+1"},
+		{command: Command{CommandType: CCommand, Comp: "D", Jump: "JGT"}, wanted: "D;JGT"},
+		{command: Command{CommandType: CCommand, Dest: "D", Comp: "0", Jump: "JMP"}, wanted: "D=0;JMP"},
+		{command: Command{CommandType: EquCommand, Symbol: "N", Value: "4", SymbolInt: 4}, wanted: ".equ N 4"},
+		{command: Command{}, wanted: ""},
+	}
+
+	for _, test := range tests {
+		if got := test.command.String(); got != test.wanted {
+			t.Errorf("Command.String() = %q, want %q", got, test.wanted)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package assembler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Position is a location in hack assembly source.
+type Position struct {
+	// File is the source file name. It can be empty when the source has no name.
+	File string
+	// Line is the line number, starting from 1
+	Line int
+	// Column is the byte offset in the line, starting from 1
+	Column int
+	// Expansion is the macro invocation which expanded the macro body at the position, or nil
+	Expansion *Expansion
+	// IncludedFrom is the position of .include which included File, or nil for the main file
+	IncludedFrom *Position
+}
+
+// Expansion is an invocation of macro.
+type Expansion struct {
+	// Macro is the name of the macro
+	Macro string
+	// Pos is the position of the invocation. It has Expansion too when the invocation is in another macro.
+	Pos Position
+}
+
+// Source returns the position which is not in a macro body: the position of the outermost
+// macro invocation for expanded code, or the position itself.
+func (p Position) Source() Position {
+	for p.Expansion != nil {
+		p = p.Expansion.Pos
+	}
+	return p
+}
+
+// Main returns the position in the main file: the position of the outermost .include
+// for positions in included files, of which macro invocations are resolved by Source.
+func (p Position) Main() Position {
+	p = p.Source()
+	for p.IncludedFrom != nil {
+		p = p.IncludedFrom.Source()
+	}
+	return p
+}
+
+// IsValid reports whether the position has a line.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns the position as file:line:column.
+// File and column are omitted when they are unknown.
+func (p Position) String() string {
+	s := p.File
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d", p.Line)
+		if p.Column > 0 {
+			s += fmt.Sprintf(":%d", p.Column)
+		}
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
+}
+
+// Severity tells whether a diagnostic stops the program from being assembled.
+type Severity int
+
+const (
+	// SeverityError makes the program fail to assemble
+	SeverityError Severity = iota
+	// SeverityWarning points out a likely mistake but the program is still assembled
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic is a problem found while parsing or encoding a program.
+// It is returned as error by Parser and Assembler.
+type Diagnostic struct {
+	Pos      Position
+	Severity Severity
+	Message  string
+}
+
+func newDiagnostic(pos Position, format string, args ...interface{}) *Diagnostic {
+	return &Diagnostic{
+		Pos:      pos,
+		Severity: SeverityError,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+func newWarning(pos Position, format string, args ...interface{}) *Diagnostic {
+	return &Diagnostic{
+		Pos:      pos,
+		Severity: SeverityWarning,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// maxExpansionNotes is the number of macro expansions shown by Diagnostic.Error without abbreviation.
+const maxExpansionNotes = 4
+
+// Error returns the diagnostic as file:line:column: message
+// Warnings are marked as file:line:column: warning: message
+// Diagnostics in macro bodies end with (in expansion of NAME at file:line) of the invocations.
+func (d *Diagnostic) Error() string {
+	message := d.Message
+	var expansions []string
+	for e := d.Pos.Expansion; e != nil; e = e.Pos.Expansion {
+		pos := Position{File: e.Pos.File, Line: e.Pos.Line}
+		expansions = append(expansions, fmt.Sprintf("in expansion of %s at %s", e.Macro, pos))
+	}
+	if len(expansions) > maxExpansionNotes {
+		// deep expansions are shown by the innermost and the outermost ones
+		n := len(expansions)
+		expansions = []string{expansions[0], fmt.Sprintf("%d more", n-2), expansions[n-1]}
+	}
+	if len(expansions) > 0 {
+		message += " (" + strings.Join(expansions, ", ") + ")"
+	}
+	if d.Severity == SeverityWarning {
+		return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, message)
+	}
+	return fmt.Sprintf("%s: %s", d.Pos, message)
+}
+
+// Diagnostics is a list of diagnostics collected in recover mode.
+// It is returned as error when it has at least one error.
+type Diagnostics []*Diagnostic
+
+// Error returns all diagnostics, one per line.
+func (l Diagnostics) Error() string {
+	lines := make([]string, len(l))
+	for i, d := range l {
+		lines[i] = d.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ErrorCount returns the number of diagnostics with Error severity.
+func (l Diagnostics) ErrorCount() int {
+	count := 0
+	for _, d := range l {
+		if d.Severity == SeverityError {
+			count += 1
+		}
+	}
+	return count
+}
+
+// Err returns the list as error if it has an error, otherwise nil.
+func (l Diagnostics) Err() error {
+	if l.ErrorCount() == 0 {
+		return nil
+	}
+	return l
+}
+
+// sort sorts diagnostics by position, keeping the order of the same position.
+func (l Diagnostics) sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		// diagnostics in macro expansions are sorted by the invocation
+		a, b := l[i].Pos.Source(), l[j].Pos.Source()
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
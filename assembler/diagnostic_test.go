@@ -0,0 +1,83 @@
+package assembler
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPosition_String(t *testing.T) {
+	tests := []struct {
+		pos    Position
+		wanted string
+	}{
+		{pos: Position{File: "Foo.asm", Line: 123, Column: 5}, wanted: "Foo.asm:123:5"},
+		{pos: Position{File: "Foo.asm", Line: 123}, wanted: "Foo.asm:123"},
+		{pos: Position{Line: 123, Column: 5}, wanted: "123:5"},
+		{pos: Position{File: "Foo.asm"}, wanted: "Foo.asm"},
+		{pos: Position{}, wanted: "-"},
+	}
+
+	for _, test := range tests {
+		if got := test.pos.String(); got != test.wanted {
+			t.Errorf("Position.String() = %s, want %s", got, test.wanted)
+		}
+	}
+}
+
+func TestDiagnostic_Error(t *testing.T) {
+	diagnostic := newDiagnostic(Position{File: "Foo.asm", Line: 123, Column: 5}, "unknown comp %q", "D+X")
+
+	wanted := `Foo.asm:123:5: unknown comp "D+X"`
+	if got := diagnostic.Error(); got != wanted {
+		t.Errorf("Diagnostic.Error() = %s, want %s", got, wanted)
+	}
+}
+
+func TestDiagnostic_Error_warning(t *testing.T) {
+	diagnostic := &Diagnostic{Pos: Position{File: "Foo.asm", Line: 3, Column: 1}, Severity: SeverityWarning, Message: "check"}
+
+	wanted := "Foo.asm:3:1: warning: check"
+	if got := diagnostic.Error(); got != wanted {
+		t.Errorf("Diagnostic.Error() = %s, want %s", got, wanted)
+	}
+}
+
+func TestDiagnostics_Err(t *testing.T) {
+	warning := &Diagnostic{Pos: Position{Line: 1}, Severity: SeverityWarning, Message: "check"}
+	err := &Diagnostic{Pos: Position{Line: 2}, Severity: SeverityError, Message: "broken"}
+
+	tests := []struct {
+		diagnostics Diagnostics
+		errorCount  int
+		isErr       bool
+	}{
+		{diagnostics: nil, errorCount: 0, isErr: false},
+		{diagnostics: Diagnostics{warning}, errorCount: 0, isErr: false},
+		{diagnostics: Diagnostics{warning, err}, errorCount: 1, isErr: true},
+	}
+
+	for _, test := range tests {
+		if got := test.diagnostics.ErrorCount(); got != test.errorCount {
+			t.Errorf("Diagnostics.ErrorCount() = %d, want %d", got, test.errorCount)
+		}
+		if got := test.diagnostics.Err(); (got != nil) != test.isErr {
+			t.Errorf("Diagnostics.Err() = %v, want error %t", got, test.isErr)
+		}
+	}
+}
+
+func TestDiagnostics_sort(t *testing.T) {
+	diagnostics := Diagnostics{
+		{Pos: Position{File: "b.asm", Line: 1, Column: 1}, Message: "4"},
+		{Pos: Position{File: "a.asm", Line: 2, Column: 1}, Message: "2"},
+		{Pos: Position{File: "a.asm", Line: 2, Column: 5}, Message: "3"},
+		{Pos: Position{File: "a.asm", Line: 1, Column: 9}, Message: "1"},
+	}
+	diagnostics.sort()
+
+	for i, diagnostic := range diagnostics {
+		if diagnostic.Message != fmt.Sprint(i+1) {
+			t.Errorf("diagnostics[%d] = %s, want %d", i, diagnostic.Message, i+1)
+		}
+	}
+}
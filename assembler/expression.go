@@ -0,0 +1,209 @@
+package assembler
+
+import "strings"
+
+// binaryPrecedence is the precedence of binary operators in expressions. Greater binds tighter.
+var binaryPrecedence = map[TokenType]int{
+	OrToken:      1,
+	AndToken:     2,
+	ShlToken:     3,
+	ShrToken:     3,
+	PlusToken:    4,
+	MinusToken:   4,
+	StarToken:    5,
+	SlashToken:   5,
+	PercentToken: 5,
+}
+
+// maxExpressionValue bounds the values in expressions, so operations on them can not overflow int64.
+const maxExpressionValue = 1 << 31
+
+// expression is a constant expression of A command or constant value, e.g. SCREEN+32*row.
+// It is a number or a symbol when op is empty, and an operation on left and right otherwise.
+// right is nil for unary minus.
+type expression struct {
+	op    Token
+	token Token
+	left  *expression
+	right *expression
+}
+
+// parseExpression parses the expression at the start of tokens.
+// It returns the number of tokens used, which is less than len(tokens) when tokens
+// have more after the expression. end is the position after the last token.
+func parseExpression(tokens []Token, end Position) (*expression, int, error) {
+	parser := &expressionParser{tokens: tokens, end: end}
+	expr, err := parser.parse(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return expr, parser.i, nil
+}
+
+type expressionParser struct {
+	tokens []Token
+	i      int
+	end    Position
+}
+
+// parse parses operations of operators with precedence greater than prec.
+func (p *expressionParser) parse(prec int) (*expression, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.i < len(p.tokens) {
+		op := p.tokens[p.i]
+		opPrec, ok := binaryPrecedence[op.Type]
+		if !ok || opPrec <= prec {
+			break
+		}
+		p.i += 1
+		right, err := p.parse(opPrec)
+		if err != nil {
+			return nil, err
+		}
+		left = &expression{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// operand parses a number, a symbol, a negated operand or an expression in parentheses.
+func (p *expressionParser) operand() (*expression, error) {
+	if p.i == len(p.tokens) {
+		if p.i == 0 {
+			return nil, newDiagnostic(p.end, "missing expression")
+		}
+		return nil, newDiagnostic(p.end, "missing operand after %s", p.tokens[p.i-1])
+	}
+
+	token := p.tokens[p.i]
+	p.i += 1
+	switch token.Type {
+	case MinusToken:
+		operand, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return &expression{op: token, left: operand}, nil
+	case LParenToken:
+		expr, err := p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.i == len(p.tokens) {
+			return nil, newDiagnostic(p.end, "missing ) in expression")
+		}
+		if p.tokens[p.i].Type != RParenToken {
+			return nil, newDiagnostic(p.tokens[p.i].Pos, "unexpected %s in expression, expected )", p.tokens[p.i])
+		}
+		p.i += 1
+		return expr, nil
+	}
+	if err := validateSymbol(token, true); err != nil {
+		return nil, err
+	}
+	return &expression{token: token}, nil
+}
+
+// symbols returns the symbols of the expression in order of appearance.
+func (e *expression) symbols() []string {
+	if e.op.Type == "" {
+		if e.token.Type == IdentToken {
+			return []string{e.token.Text}
+		}
+		return nil
+	}
+	symbols := e.left.symbols()
+	if e.right != nil {
+		symbols = append(symbols, e.right.symbols()...)
+	}
+	return symbols
+}
+
+// eval evaluates the expression. symbol returns the value of a symbol.
+func (e *expression) eval(symbol func(name string) (int64, error)) (int64, error) {
+	if e.op.Type == "" {
+		if e.token.Type == NumberToken || e.token.Type == CharToken {
+			n, ok := parseNumber(e.token.Text)
+			if !ok || n > maxExpressionValue {
+				return 0, newDiagnostic(e.token.Pos, "number %s is too large", e.token.Text)
+			}
+			return n, nil
+		}
+		return symbol(e.token.Text)
+	}
+
+	left, err := e.left.eval(symbol)
+	if err != nil {
+		return 0, err
+	}
+	if e.right == nil {
+		return -left, nil
+	}
+	right, err := e.right.eval(symbol)
+	if err != nil {
+		return 0, err
+	}
+
+	var result int64
+	switch e.op.Type {
+	case PlusToken:
+		result = left + right
+	case MinusToken:
+		result = left - right
+	case StarToken:
+		result = left * right
+	case SlashToken, PercentToken:
+		if right == 0 {
+			return 0, newDiagnostic(e.op.Pos, "division by zero")
+		}
+		if e.op.Type == SlashToken {
+			result = left / right
+		} else {
+			result = left % right
+		}
+	case AndToken:
+		result = left & right
+	case OrToken:
+		result = left | right
+	case ShlToken, ShrToken:
+		if right < 0 || right > 63 {
+			return 0, newDiagnostic(e.op.Pos, "invalid shift count %d", right)
+		}
+		if e.op.Type == ShrToken {
+			result = left >> uint(right)
+		} else if left != 0 && right > 32 {
+			// shifted out of the range, which can overflow int64
+			return 0, newDiagnostic(e.op.Pos, "overflow in %d %s %d", left, e.op.Text, right)
+		} else {
+			result = left << uint(right)
+		}
+	default:
+		return 0, newDiagnostic(e.op.Pos, "unknown operator %s", e.op)
+	}
+	// operands are in the range, so the result has not overflowed yet
+	if result > maxExpressionValue || result < -maxExpressionValue {
+		return 0, newDiagnostic(e.op.Pos, "overflow in %d %s %d", left, e.op.Text, right)
+	}
+	return result, nil
+}
+
+// parseExpressionText parses the expression text of A command or constant value.
+// The text is a valid expression made by joinTokens, so positions of tokens are set to pos.
+func parseExpressionText(text string, pos Position) (*expression, error) {
+	lexer := NewLexer(strings.NewReader(text), pos.File)
+	var tokens []Token
+	for token := lexer.Next(); token.Type != NewlineToken && token.Type != EOFToken; token = lexer.Next() {
+		token.Pos = pos
+		tokens = append(tokens, token)
+	}
+	expr, n, err := parseExpression(tokens, pos)
+	if err != nil {
+		return nil, err
+	}
+	if n < len(tokens) {
+		return nil, newDiagnostic(pos, "unexpected %s in expression", tokens[n])
+	}
+	return expr, nil
+}
@@ -0,0 +1,54 @@
+package assembler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		source  string
+		used    int
+		symbols []string
+		value   int64
+	}{
+		{source: "1", used: 1, value: 1},
+		{source: "a", used: 1, symbols: []string{"a"}, value: 10},
+		{source: "a+b*2", used: 5, symbols: []string{"a", "b"}, value: 50},
+		{source: "(a+b)*2", used: 7, symbols: []string{"a", "b"}, value: 60},
+		{source: "a-b-5", used: 5, symbols: []string{"a", "b"}, value: -15},
+		{source: "--a", used: 3, symbols: []string{"a"}, value: 10},
+		{source: "1<<2+1", used: 5, value: 8},
+		{source: "b>>1&3", used: 5, symbols: []string{"b"}, value: 2},
+		{source: "a|b&1", used: 5, symbols: []string{"a", "b"}, value: 10},
+		{source: "a%3*b/4", used: 7, symbols: []string{"a", "b"}, value: 5},
+		{source: "a b", used: 1, symbols: []string{"a"}, value: 10},
+	}
+	values := map[string]int64{"a": 10, "b": 20}
+
+	for _, test := range tests {
+		lexer := NewLexer(strings.NewReader(test.source), "")
+		var tokens []Token
+		for token := lexer.Next(); token.Type != NewlineToken; token = lexer.Next() {
+			tokens = append(tokens, token)
+		}
+		expr, used, err := parseExpression(tokens, Position{})
+		if err != nil {
+			t.Errorf("parseExpression(%q): unexpected error '%s'", test.source, err)
+			continue
+		}
+		if used != test.used {
+			t.Errorf("parseExpression(%q) used %d tokens, want %d", test.source, used, test.used)
+		}
+		if got := expr.symbols(); !reflect.DeepEqual(got, test.symbols) {
+			t.Errorf("parseExpression(%q).symbols() = %v, want %v", test.source, got, test.symbols)
+		}
+		got, err := expr.eval(func(name string) (int64, error) {
+			return values[name], nil
+		})
+		if err != nil || got != test.value {
+			t.Errorf("parseExpression(%q).eval() = %d, %v, want %d", test.source, got, err, test.value)
+		}
+	}
+}
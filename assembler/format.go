@@ -0,0 +1,423 @@
+package assembler
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Format writes machine code words of a program in an encoding.
+type Format interface {
+	// Name selects the format, e.g. with -format flag of hackasm
+	Name() string
+	// Extension is the file extension of the output including ".", e.g. ".hack"
+	Extension() string
+	// Write writes words to writer. The first word is at ROM address 0.
+	Write(writer io.Writer, words []uint16) error
+}
+
+// FormatReader is a Format which can be read back to machine code words.
+type FormatReader interface {
+	Format
+	// Read reads words written by Write
+	Read(reader io.Reader) ([]uint16, error)
+}
+
+var (
+	// HackFormat is the text format of Nand2Tetris: 16 characters of 0 and 1 per line
+	HackFormat Format = hackFormat{}
+	// BinaryFormat is raw machine code: 2 bytes per word in big endian
+	BinaryFormat Format = binaryFormat{}
+	// IntelHexFormat is Intel HEX with byte addresses, 2 bytes per word in big endian
+	IntelHexFormat Format = intelHexFormat{}
+	// ReadmembFormat can be loaded by $readmemb of Verilog: a binary word per line
+	ReadmembFormat Format = readmemFormat{name: "readmemb", base: 2}
+	// ReadmemhFormat can be loaded by $readmemh of Verilog: a hex word per line
+	ReadmemhFormat Format = readmemFormat{name: "readmemh", base: 16}
+	// LogisimFormat is the ROM image which can be loaded to Logisim ROM component
+	LogisimFormat Format = logisimFormat{}
+	// GoFormat is a Go slice literal of uint16 named rom
+	GoFormat Format = arrayFormat{name: "go", extension: ".go",
+		header: "var rom = []uint16{\n", footer: "}\n"}
+	// CFormat is a C array literal of uint16_t named rom
+	CFormat Format = arrayFormat{name: "c", extension: ".c",
+		header: "#include <stdint.h>\n\nconst uint16_t rom[] = {\n", footer: "};\n"}
+)
+
+// formats has all formats in the order shown to users.
+var formats = []Format{
+	HackFormat, BinaryFormat, IntelHexFormat, ReadmembFormat, ReadmemhFormat, LogisimFormat, GoFormat, CFormat,
+}
+
+// Formats returns all supported formats.
+func Formats() []Format {
+	return append([]Format{}, formats...)
+}
+
+// LookupFormatByExtension returns the format with extension ext, e.g. ".hack".
+// It returns error when formats share the extension, like readmemb and readmemh of ".mem".
+func LookupFormatByExtension(ext string) (Format, error) {
+	var names []string
+	var found Format
+	for _, format := range formats {
+		if format.Extension() == ext {
+			names = append(names, format.Name())
+			found = format
+		}
+	}
+	switch len(names) {
+	case 0:
+		return nil, errors.New(fmt.Sprintf("unknown format for extension %q", ext))
+	case 1:
+		return found, nil
+	}
+	return nil, errors.New(fmt.Sprintf("extension %q is used by formats %s, the format should be given", ext, strings.Join(names, ", ")))
+}
+
+// LookupFormat returns the format with name.
+func LookupFormat(name string) (Format, error) {
+	for _, format := range formats {
+		if format.Name() == name {
+			return format, nil
+		}
+	}
+
+	names := make([]string, len(formats))
+	for i, format := range formats {
+		names[i] = format.Name()
+	}
+	return nil, errors.New(fmt.Sprintf("unknown format %q, should be one of %s", name, strings.Join(names, ", ")))
+}
+
+type hackFormat struct{}
+
+func (hackFormat) Name() string      { return "hack" }
+func (hackFormat) Extension() string { return ".hack" }
+
+func (hackFormat) Write(writer io.Writer, words []uint16) error {
+	buffered := bufio.NewWriter(writer)
+	for _, word := range words {
+		fmt.Fprintf(buffered, "%016b\n", word)
+	}
+	return buffered.Flush()
+}
+
+func (hackFormat) Read(reader io.Reader) ([]uint16, error) {
+	var words []uint16
+	scanner := bufio.NewScanner(reader)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if len(line) != 16 {
+			return nil, errors.New(fmt.Sprintf("line %d: %q is not 16 bits", lineNumber, line))
+		}
+		word, err := strconv.ParseUint(line, 2, 16)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("line %d: %q is not binary", lineNumber, line))
+		}
+		words = append(words, uint16(word))
+	}
+	return words, scanner.Err()
+}
+
+type binaryFormat struct{}
+
+func (binaryFormat) Name() string      { return "bin" }
+func (binaryFormat) Extension() string { return ".bin" }
+
+func (binaryFormat) Write(writer io.Writer, words []uint16) error {
+	return binary.Write(writer, binary.BigEndian, words)
+}
+
+func (binaryFormat) Read(reader io.Reader) ([]uint16, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%2 != 0 {
+		return nil, errors.New(fmt.Sprintf("binary has odd length %d", len(data)))
+	}
+	return bytesToWords(data), nil
+}
+
+// bytesToWords converts big endian bytes to words.
+func bytesToWords(data []byte) []uint16 {
+	words := make([]uint16, len(data)/2)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(data[i*2:])
+	}
+	return words
+}
+
+type intelHexFormat struct{}
+
+func (intelHexFormat) Name() string      { return "ihex" }
+func (intelHexFormat) Extension() string { return ".hex" }
+
+// intelHexRecordSize is the number of data bytes in a record
+const intelHexRecordSize = 16
+
+func (intelHexFormat) Write(writer io.Writer, words []uint16) error {
+	data := make([]byte, len(words)*2)
+	for i, word := range words {
+		binary.BigEndian.PutUint16(data[i*2:], word)
+	}
+
+	buffered := bufio.NewWriter(writer)
+	for addr := 0; addr < len(data); addr += intelHexRecordSize {
+		end := addr + intelHexRecordSize
+		if end > len(data) {
+			end = len(data)
+		}
+		writeIntelHexRecord(buffered, uint16(addr), 0x00, data[addr:end])
+	}
+	// end of file record
+	writeIntelHexRecord(buffered, 0, 0x01, nil)
+	return buffered.Flush()
+}
+
+// writeIntelHexRecord writes ":" count address type data checksum
+func writeIntelHexRecord(writer io.Writer, addr uint16, recordType byte, data []byte) {
+	record := []byte{byte(len(data)), byte(addr >> 8), byte(addr), recordType}
+	record = append(record, data...)
+
+	sum := byte(0)
+	for _, b := range record {
+		sum += b
+	}
+	// checksum is two's complement of the sum of all bytes
+	record = append(record, -sum)
+
+	fmt.Fprintf(writer, ":%X\n", record)
+}
+
+func (intelHexFormat) Read(reader io.Reader) ([]uint16, error) {
+	var data []byte
+	scanner := bufio.NewScanner(reader)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, ":") {
+			return nil, errors.New(fmt.Sprintf("line %d: record should start with \":\"", lineNumber))
+		}
+		record, err := hex.DecodeString(line[1:])
+		if err != nil || len(record) < 5 || int(record[0]) != len(record)-5 {
+			return nil, errors.New(fmt.Sprintf("line %d: invalid record %q", lineNumber, line))
+		}
+		sum := byte(0)
+		for _, b := range record {
+			sum += b
+		}
+		if sum != 0 {
+			return nil, errors.New(fmt.Sprintf("line %d: checksum mismatch", lineNumber))
+		}
+
+		addr := int(record[1])<<8 | int(record[2])
+		recordType, recordData := record[3], record[4:len(record)-1]
+		switch recordType {
+		case 0x00:
+			// data record
+			if end := addr + len(recordData); end > len(data) {
+				data = append(data, make([]byte, end-len(data))...)
+			}
+			copy(data[addr:], recordData)
+		case 0x01:
+			// end of file record
+			if len(data)%2 != 0 {
+				data = append(data, 0)
+			}
+			return bytesToWords(data), nil
+		default:
+			return nil, errors.New(fmt.Sprintf("line %d: unsupported record type %02X", lineNumber, recordType))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("missing end of file record")
+}
+
+type readmemFormat struct {
+	name string
+	base int
+}
+
+func (f readmemFormat) Name() string    { return f.name }
+func (readmemFormat) Extension() string { return ".mem" }
+
+func (f readmemFormat) Write(writer io.Writer, words []uint16) error {
+	format := "%016b\n"
+	if f.base == 16 {
+		format = "%04x\n"
+	}
+
+	buffered := bufio.NewWriter(writer)
+	for _, word := range words {
+		fmt.Fprintf(buffered, format, word)
+	}
+	return buffered.Flush()
+}
+
+// Read reads words of readmem file. Comments, "_" in numbers and @address are supported.
+func (f readmemFormat) Read(reader io.Reader) ([]uint16, error) {
+	var words []uint16
+	addr := 0
+	scanner := bufio.NewScanner(reader)
+	inBlockComment := false
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		line, inBlockComment = removeComments(line, inBlockComment)
+		for _, field := range strings.Fields(line) {
+			if strings.HasPrefix(field, "@") {
+				next, err := strconv.ParseUint(field[1:], 16, 16)
+				if err != nil {
+					return nil, errors.New(fmt.Sprintf("line %d: invalid address %q", lineNumber, field))
+				}
+				addr = int(next)
+				continue
+			}
+			word, err := strconv.ParseUint(strings.ReplaceAll(field, "_", ""), f.base, 16)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("line %d: invalid word %q", lineNumber, field))
+			}
+			if addr >= len(words) {
+				words = append(words, make([]uint16, addr-len(words)+1)...)
+			}
+			words[addr] = uint16(word)
+			addr += 1
+		}
+	}
+	return words, scanner.Err()
+}
+
+// removeComments removes // and /* */ comments of line.
+// inBlockComment tells whether line starts in /* */ comment, and it is returned for the next line.
+func removeComments(line string, inBlockComment bool) (string, bool) {
+	var builder strings.Builder
+	for line != "" {
+		if inBlockComment {
+			end := strings.Index(line, "*/")
+			if end < 0 {
+				return builder.String(), true
+			}
+			line = line[end+2:]
+			inBlockComment = false
+			// comment separates words
+			builder.WriteString(" ")
+			continue
+		}
+		lineComment, blockComment := strings.Index(line, "//"), strings.Index(line, "/*")
+		if lineComment >= 0 && (blockComment < 0 || lineComment < blockComment) {
+			builder.WriteString(line[:lineComment])
+			return builder.String(), false
+		}
+		if blockComment < 0 {
+			builder.WriteString(line)
+			break
+		}
+		builder.WriteString(line[:blockComment])
+		line = line[blockComment+2:]
+		inBlockComment = true
+	}
+	return builder.String(), inBlockComment
+}
+
+type logisimFormat struct{}
+
+func (logisimFormat) Name() string      { return "logisim" }
+func (logisimFormat) Extension() string { return ".rom" }
+
+// logisimWordsPerLine is the number of words in a line like Logisim saves images
+const logisimWordsPerLine = 8
+
+func (logisimFormat) Write(writer io.Writer, words []uint16) error {
+	buffered := bufio.NewWriter(writer)
+	buffered.WriteString("v2.0 raw\n")
+	for i, word := range words {
+		separator := " "
+		if i%logisimWordsPerLine == logisimWordsPerLine-1 || i == len(words)-1 {
+			separator = "\n"
+		}
+		fmt.Fprintf(buffered, "%x%s", word, separator)
+	}
+	return buffered.Flush()
+}
+
+// Read reads words of Logisim image. Run length encoding like "4*0" is supported.
+func (logisimFormat) Read(reader io.Reader) ([]uint16, error) {
+	var words []uint16
+	scanner := bufio.NewScanner(reader)
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "v2.0 raw" {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("logisim image should start with \"v2.0 raw\"")
+	}
+	for lineNumber := 2; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		for _, field := range strings.Fields(line) {
+			count := uint64(1)
+			value := field
+			if i := strings.Index(field, "*"); i >= 0 {
+				var err error
+				if count, err = strconv.ParseUint(field[:i], 10, 16); err != nil {
+					return nil, errors.New(fmt.Sprintf("line %d: invalid count %q", lineNumber, field))
+				}
+				value = field[i+1:]
+			}
+			word, err := strconv.ParseUint(value, 16, 16)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("line %d: invalid word %q", lineNumber, field))
+			}
+			for i := uint64(0); i < count; i++ {
+				words = append(words, uint16(word))
+			}
+		}
+	}
+	return words, scanner.Err()
+}
+
+// arrayFormat is an array literal of a programming language.
+type arrayFormat struct {
+	name      string
+	extension string
+	header    string
+	footer    string
+}
+
+func (f arrayFormat) Name() string      { return f.name }
+func (f arrayFormat) Extension() string { return f.extension }
+
+// arrayWordsPerLine is the number of words in a line of array literal
+const arrayWordsPerLine = 8
+
+func (f arrayFormat) Write(writer io.Writer, words []uint16) error {
+	buffered := bufio.NewWriter(writer)
+	buffered.WriteString(f.header)
+	for i, word := range words {
+		if i%arrayWordsPerLine == 0 {
+			buffered.WriteString("\t")
+		}
+		fmt.Fprintf(buffered, "0x%04x,", word)
+		if i%arrayWordsPerLine == arrayWordsPerLine-1 || i == len(words)-1 {
+			buffered.WriteString("\n")
+		} else {
+			buffered.WriteString(" ")
+		}
+	}
+	buffered.WriteString(f.footer)
+	return buffered.Flush()
+}
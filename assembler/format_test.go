@@ -0,0 +1,161 @@
+package assembler
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormat_Write(t *testing.T) {
+	// Add.asm: @2 D=A @3 D=D+A @0 M=D
+	words := []uint16{0x0002, 0xec10, 0x0003, 0xe090, 0x0000, 0xe308}
+	// 9 words to check line breaks
+	longWords := []uint16{0, 1, 2, 3, 4, 5, 6, 7, 0xffff}
+
+	tests := []struct {
+		format Format
+		words  []uint16
+		wanted string
+	}{
+		{format: HackFormat, words: words[:2], wanted: "0000000000000010\n1110110000010000\n"},
+		{format: BinaryFormat, words: words[:2], wanted: "\x00\x02\xec\x10"},
+		{format: IntelHexFormat, words: words, wanted: ":0C0000000002EC100003E0900000E30898\n:00000001FF\n"},
+		{format: IntelHexFormat, words: longWords,
+			wanted: ":1000000000000001000200030004000500060007D4\n:02001000FFFFF0\n:00000001FF\n"},
+		{format: ReadmembFormat, words: words[:2], wanted: "0000000000000010\n1110110000010000\n"},
+		{format: ReadmemhFormat, words: words[:2], wanted: "0002\nec10\n"},
+		{format: LogisimFormat, words: longWords, wanted: "v2.0 raw\n0 1 2 3 4 5 6 7\nffff\n"},
+		{format: GoFormat, words: longWords, wanted: "var rom = []uint16{\n" +
+			"\t0x0000, 0x0001, 0x0002, 0x0003, 0x0004, 0x0005, 0x0006, 0x0007,\n" +
+			"\t0xffff,\n" +
+			"}\n"},
+		{format: CFormat, words: words[:2], wanted: "#include <stdint.h>\n\nconst uint16_t rom[] = {\n" +
+			"\t0x0002, 0xec10,\n" +
+			"};\n"},
+	}
+
+	for _, test := range tests {
+		writer := new(bytes.Buffer)
+		if err := test.format.Write(writer, test.words); err != nil {
+			t.Errorf("%s Format.Write() results in error: %s", test.format.Name(), err)
+		}
+		if got := writer.String(); got != test.wanted {
+			t.Errorf("%s Format.Write() = %q, want %q", test.format.Name(), got, test.wanted)
+		}
+	}
+}
+
+func TestLookupFormat(t *testing.T) {
+	for _, format := range Formats() {
+		got, err := LookupFormat(format.Name())
+		if err != nil {
+			t.Errorf("LookupFormat(%s) results in error: %s", format.Name(), err)
+		}
+		if got != format {
+			t.Errorf("LookupFormat(%s) = %s, want %s", format.Name(), got.Name(), format.Name())
+		}
+		if !strings.HasPrefix(format.Extension(), ".") {
+			t.Errorf("%s Format.Extension() = %s, should start with .", format.Name(), format.Extension())
+		}
+	}
+
+	if _, err := LookupFormat("pdf"); err == nil {
+		t.Errorf("LookupFormat(pdf) should return error")
+	}
+}
+
+func TestFormatReader_Read(t *testing.T) {
+	words := []uint16{0x0002, 0xec10, 0x0003, 0xe090, 0x0000, 0xe308}
+	longWords := []uint16{0, 1, 2, 3, 4, 5, 6, 7, 0xffff}
+
+	// every format but source code literals reads what it writes
+	for _, format := range Formats() {
+		reader, ok := format.(FormatReader)
+		if !ok {
+			continue
+		}
+		for _, test := range [][]uint16{words, longWords} {
+			writer := new(bytes.Buffer)
+			if err := format.Write(writer, test); err != nil {
+				t.Fatalf("%s Format.Write() results in error: %s", format.Name(), err)
+			}
+			got, err := reader.Read(writer)
+			if err != nil {
+				t.Errorf("%s FormatReader.Read() results in error: %s", format.Name(), err)
+				continue
+			}
+			if !reflect.DeepEqual(got, test) {
+				t.Errorf("%s FormatReader.Read() = %v, want %v", format.Name(), got, test)
+			}
+		}
+	}
+
+	tests := []struct {
+		format FormatReader
+		input  string
+		wanted []uint16
+	}{
+		{format: HackFormat.(FormatReader), input: "0000000000000010\r\n\n1110110000010000", wanted: words[:2]},
+		{format: ReadmembFormat.(FormatReader), input: "// comment\n0000_0000_0000_0010 /* block\n comment */ 1110110000010000\n",
+			wanted: words[:2]},
+		{format: ReadmemhFormat.(FormatReader), input: "@2 ec10\n@0 0002", wanted: []uint16{0x0002, 0, 0xec10}},
+		{format: LogisimFormat.(FormatReader), input: "v2.0 raw\n3*0 ffff # comment\n", wanted: []uint16{0, 0, 0, 0xffff}},
+	}
+	for _, test := range tests {
+		got, err := test.format.Read(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("%s FormatReader.Read(%q) results in error: %s", test.format.Name(), test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.wanted) {
+			t.Errorf("%s FormatReader.Read(%q) = %v, want %v", test.format.Name(), test.input, got, test.wanted)
+		}
+	}
+
+	errorTests := []struct {
+		format FormatReader
+		input  string
+	}{
+		{format: HackFormat.(FormatReader), input: "000000000000001\n"},
+		{format: HackFormat.(FormatReader), input: "000000000000002x\n"},
+		{format: BinaryFormat.(FormatReader), input: "\x00\x02\xec"},
+		{format: IntelHexFormat.(FormatReader), input: ":0C0000000002EC100003E0900000E30899\n:00000001FF\n"},
+		{format: IntelHexFormat.(FormatReader), input: ":0C0000000002EC100003E0900000E30898\n"},
+		{format: ReadmemhFormat.(FormatReader), input: "0002 xyz\n"},
+		{format: LogisimFormat.(FormatReader), input: "0002\n"},
+	}
+	for _, test := range errorTests {
+		if _, err := test.format.Read(strings.NewReader(test.input)); err == nil {
+			t.Errorf("%s FormatReader.Read(%q) should return error", test.format.Name(), test.input)
+		}
+	}
+}
+
+func TestLookupFormatByExtension(t *testing.T) {
+	tests := []struct {
+		extension string
+		wanted    Format
+	}{
+		{extension: ".hack", wanted: HackFormat},
+		{extension: ".hex", wanted: IntelHexFormat},
+	}
+	for _, test := range tests {
+		got, err := LookupFormatByExtension(test.extension)
+		if err != nil {
+			t.Errorf("LookupFormatByExtension(%s) results in error: %s", test.extension, err)
+			continue
+		}
+		if got != test.wanted {
+			t.Errorf("LookupFormatByExtension(%s) = %s, want %s", test.extension, got.Name(), test.wanted.Name())
+		}
+	}
+
+	if _, err := LookupFormatByExtension(".pdf"); err == nil {
+		t.Errorf("LookupFormatByExtension(.pdf) should return error")
+	}
+	// readmemb and readmemh
+	if _, err := LookupFormatByExtension(".mem"); err == nil {
+		t.Errorf("LookupFormatByExtension(.mem) should return error")
+	}
+}
@@ -0,0 +1,83 @@
+package assembler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// includeDirective reads another source file in place of the line, e.g. .include "math.asm".
+// The file is searched relative to the including file, and then in IncludePath of Parser.
+const includeDirective = ".include"
+
+// include starts reading the file of `.include "name"` line. The rest of the current file
+// is read after the included file.
+func (p *Parser) include(line sourceLine) *Diagnostic {
+	tokens := line.tokens[1:]
+	if len(tokens) == 0 {
+		return newDiagnostic(line.pos, "missing file name after %s", includeDirective)
+	}
+	if tokens[0].Type != StringToken {
+		return newDiagnostic(tokens[0].Pos, "unexpected %s, expected file name in quotes", tokens[0])
+	}
+	if len(tokens) > 1 {
+		return newDiagnostic(tokens[1].Pos, "unexpected %s after file name", tokens[1])
+	}
+	name := tokens[0].Text[1 : len(tokens[0].Text)-1]
+	if name == "" {
+		return newDiagnostic(tokens[0].Pos, "empty file name in %s", includeDirective)
+	}
+	if p.FS == nil {
+		return newDiagnostic(tokens[0].Pos, "cannot include %q without a file system", name)
+	}
+
+	file, data, err := p.findInclude(name)
+	if err != nil {
+		return newDiagnostic(tokens[0].Pos, "%s", err)
+	}
+
+	// files being read, from the main file to the current file
+	files := []string{}
+	for _, lexer := range append(p.includes, p.lexer) {
+		files = append(files, lexer.filename)
+	}
+	for _, f := range files {
+		if f == file {
+			return newDiagnostic(tokens[0].Pos, "include cycle: %s -> %s", strings.Join(files, " -> "), file)
+		}
+	}
+
+	lexer := NewLexer(bytes.NewReader(data), file)
+	lexer.includedFrom = &line.pos
+	p.includes = append(p.includes, p.lexer)
+	p.lexer = lexer
+	return nil
+}
+
+// findInclude returns the path and the content of the included file name.
+func (p *Parser) findInclude(name string) (string, []byte, error) {
+	var candidates []string
+	if path.IsAbs(name) {
+		candidates = []string{name}
+	} else {
+		candidates = append(candidates, path.Join(path.Dir(p.lexer.filename), name))
+		for _, dir := range p.IncludePath {
+			candidates = append(candidates, path.Join(dir, name))
+		}
+	}
+
+	for _, file := range candidates {
+		data, err := fs.ReadFile(p.FS, file)
+		if err == nil {
+			return file, data, nil
+		}
+		// paths out of the file system are invalid, and can be found in IncludePath
+		if !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, fs.ErrInvalid) {
+			return "", nil, errors.New(fmt.Sprintf("error when reading included file: %s", err))
+		}
+	}
+	return "", nil, errors.New(fmt.Sprintf("included file %q not found", name))
+}
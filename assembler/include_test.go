@@ -0,0 +1,137 @@
+package assembler
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAssembler_WriteBinaryCode_include(t *testing.T) {
+	fsys := fstest.MapFS{
+		"src/Main.asm":     {Data: []byte(".include \"lib/math.asm\"\n@END\n(END)\n.include \"io.asm\"\n")},
+		"src/lib/math.asm": {Data: []byte(".equ TWO 2\n.include \"inc.asm\"\n")},
+		"src/lib/inc.asm":  {Data: []byte("@TWO\nD=A\n")},
+		"std/io.asm":       {Data: []byte("@KBD\n")},
+	}
+	code := new(strings.Builder)
+	assembler := NewFS(fsys, "src/Main.asm", code)
+	assembler.IncludePath = []string{"std"}
+	if err := assembler.WriteBinaryCode(); err != nil {
+		t.Fatalf("assembler.WriteBinaryCode() results in error: %s", err)
+	}
+
+	wanted := "0000000000000010\n1110110000010000\n0000000000000011\n0110000000000000\n"
+	if got := code.String(); got != wanted {
+		t.Errorf("code = %q, want %q", got, wanted)
+	}
+
+	// commands have positions in their files
+	commands := assembler.Parser.Commands
+	if pos := commands[1].Pos; pos.File != "src/lib/inc.asm" || pos.Line != 1 {
+		t.Errorf("Commands[1].Pos = %s, want src/lib/inc.asm:1", pos)
+	}
+	if from := commands[1].Pos.IncludedFrom; from == nil || from.File != "src/lib/math.asm" || from.Line != 2 ||
+		from.IncludedFrom == nil || from.IncludedFrom.File != "src/Main.asm" || from.IncludedFrom.Line != 1 {
+		t.Errorf("Commands[1].Pos.IncludedFrom = %+v, want src/lib/math.asm:2 in src/Main.asm:1", from)
+	}
+	if pos := commands[3].Pos; pos.File != "src/Main.asm" || pos.Line != 2 || pos.IncludedFrom != nil {
+		t.Errorf("Commands[3].Pos = %+v, want src/Main.asm:2", pos)
+	}
+}
+
+func TestAssembler_WriteBinaryCode_includeError(t *testing.T) {
+	tests := []struct {
+		files  map[string]string
+		wanted string
+	}{
+		{
+			files:  map[string]string{"Foo.asm": ".include \"Bar.asm\"\n", "Bar.asm": "@1\nD=X\n"},
+			wanted: `Bar.asm:2:1: unknown comp "X"`,
+		},
+		{
+			files:  map[string]string{"Foo.asm": ".include \"Bar.asm\"\n", "Bar.asm": "@1\n.include \"Foo.asm\"\n"},
+			wanted: `Bar.asm:2:10: include cycle: Foo.asm -> Bar.asm -> Foo.asm`,
+		},
+		{
+			files:  map[string]string{"Foo.asm": ".include \"Foo.asm\"\n"},
+			wanted: `Foo.asm:1:10: include cycle: Foo.asm -> Foo.asm`,
+		},
+		{
+			files:  map[string]string{"Foo.asm": "@1\n.include \"lib/Bar.asm\"\n"},
+			wanted: `Foo.asm:2:10: included file "lib/Bar.asm" not found`,
+		},
+		{
+			files:  map[string]string{"lib/Foo.asm": ".include \"../../Bar.asm\"\n"},
+			wanted: `lib/Foo.asm:1:10: included file "../../Bar.asm" not found`,
+		},
+		{files: map[string]string{"Foo.asm": ".include\n"}, wanted: `Foo.asm:1:1: missing file name after .include`},
+		{files: map[string]string{"Foo.asm": ".include Bar.asm\n"}, wanted: `Foo.asm:1:10: unexpected "Bar.asm", expected file name in quotes`},
+		{files: map[string]string{"Foo.asm": ".include \"Bar.asm\" 1\n"}, wanted: `Foo.asm:1:20: unexpected "1" after file name`},
+		{files: map[string]string{"Foo.asm": ".include \"\"\n"}, wanted: `Foo.asm:1:10: empty file name in .include`},
+		{
+			files:  map[string]string{"Foo.asm": ".macro INC\n.include \"Bar.asm\"\n.endm\n", "Bar.asm": ""},
+			wanted: `Foo.asm:2:1: .include in macro "INC"`,
+		},
+	}
+	for _, test := range tests {
+		fsys := fstest.MapFS{}
+		for name, data := range test.files {
+			fsys[name] = &fstest.MapFile{Data: []byte(data)}
+		}
+		name := "Foo.asm"
+		if _, ok := test.files[name]; !ok {
+			name = "lib/Foo.asm"
+		}
+		assembler := NewFS(fsys, name, ioutil.Discard)
+		err := assembler.WriteBinaryCode()
+		if err == nil || err.Error() != test.wanted {
+			t.Errorf("assembler.WriteBinaryCode() error = %v, want %s", err, test.wanted)
+		}
+	}
+}
+
+func TestAssembler_WriteBinaryCode_includeWithoutFS(t *testing.T) {
+	assembler := New(strings.NewReader(".include \"Bar.asm\"\n"), ioutil.Discard)
+	assembler.Filename = "Foo.asm"
+	err := assembler.WriteBinaryCode()
+	wanted := `Foo.asm:1:10: cannot include "Bar.asm" without a file system`
+	if err == nil || err.Error() != wanted {
+		t.Errorf("assembler.WriteBinaryCode() error = %v, want %s", err, wanted)
+	}
+
+	if err := NewFS(fstest.MapFS{}, "Foo.asm", ioutil.Discard).WriteBinaryCode(); err == nil {
+		t.Errorf("assembler.WriteBinaryCode() should return error for missing Foo.asm")
+	}
+	if err := New(nil, ioutil.Discard).WriteBinaryCode(); err == nil {
+		t.Errorf("assembler.WriteBinaryCode() should return error without reader and FS")
+	}
+}
+
+func TestAssembler_WriteBinaryCode_listingInclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Foo.asm": {Data: []byte("@1\n.include \"Bar.asm\" // bar\nD=A\n")},
+		"Bar.asm": {Data: []byte(".macro ONE\n@1\n.endm\n(BAR)\nONE\n")},
+	}
+	listing := new(bytes.Buffer)
+	assembler := NewFS(fsys, "Foo.asm", ioutil.Discard)
+	assembler.Listing = listing
+	if err := assembler.WriteBinaryCode(); err != nil {
+		t.Fatalf("assembler.WriteBinaryCode() results in error: %s", err)
+	}
+
+	wanted := `  ROM  BINARY            HEX   LINE  SOURCE
+    0  0000000000000001  0001     1  @1
+                                  2  .include "Bar.asm" // bar
+    1                             2  Bar.asm:4: (BAR)
+    1  0000000000000001  0001     2  Bar.asm:5: + @1
+    2  1110110000010000  EC10     3  D=A
+
+SYMBOL  KIND        ADDRESS  USES
+BAR     label             1  0
+`
+	if got := listing.String(); got != wanted {
+		t.Errorf("listing =\n%s\nwant\n%s", got, wanted)
+	}
+}
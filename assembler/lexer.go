@@ -0,0 +1,247 @@
+package assembler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// TokenType is the kind of Token.
+type TokenType string
+
+const (
+	IllegalToken   TokenType = "ILLEGAL"
+	EOFToken       TokenType = "EOF"
+	NewlineToken   TokenType = "NEWLINE"
+	CommentToken   TokenType = "COMMENT"
+	IdentToken     TokenType = "IDENT"
+	NumberToken    TokenType = "NUMBER"
+	CharToken      TokenType = "CHAR"
+	StringToken    TokenType = "STRING"
+	AtToken        TokenType = "@"
+	LParenToken    TokenType = "("
+	RParenToken    TokenType = ")"
+	AssignToken    TokenType = "="
+	SemicolonToken TokenType = ";"
+	PlusToken      TokenType = "+"
+	MinusToken     TokenType = "-"
+	NotToken       TokenType = "!"
+	AndToken       TokenType = "&"
+	OrToken        TokenType = "|"
+	StarToken      TokenType = "*"
+	SlashToken     TokenType = "/"
+	PercentToken   TokenType = "%"
+	ShlToken       TokenType = "<<"
+	ShrToken       TokenType = ">>"
+	CommaToken     TokenType = ","
+)
+
+// punctuations maps one character punctuations to token type.
+var punctuations = map[byte]TokenType{
+	'@': AtToken,
+	'(': LParenToken,
+	')': RParenToken,
+	'=': AssignToken,
+	';': SemicolonToken,
+	'+': PlusToken,
+	'-': MinusToken,
+	'!': NotToken,
+	'&': AndToken,
+	'|': OrToken,
+	'*': StarToken,
+	'/': SlashToken,
+	'%': PercentToken,
+	',': CommaToken,
+}
+
+// shifts maps two character shift operators to token type.
+var shifts = map[string]TokenType{
+	"<<": ShlToken,
+	">>": ShrToken,
+}
+
+// Token is a lexical unit of hack assembly source.
+type Token struct {
+	Type TokenType
+	// Text is the source text of the token. COMMENT token text includes "//".
+	Text string
+	Pos  Position
+}
+
+// String describes the token for diagnostics.
+func (t Token) String() string {
+	switch t.Type {
+	case EOFToken:
+		return "end of file"
+	case NewlineToken:
+		return "end of line"
+	}
+	return fmt.Sprintf("%q", t.Text)
+}
+
+// isSymbolChar reports whether c can be a part of hack symbol or number.
+// Hack symbols consist of letters, digits, '_', '.', '$' and ':'.
+func isSymbolChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '_' || c == '.' || c == '$' || c == ':'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// charLiteral returns the character code of s like 'A'. The character is printable ASCII,
+// and ' and \ are escaped by \.
+func charLiteral(s string) (byte, bool) {
+	if len(s) < 3 || s[0] != '\'' || s[len(s)-1] != '\'' {
+		return 0, false
+	}
+	inner := s[1 : len(s)-1]
+	if len(inner) == 2 && inner[0] == '\\' && (inner[1] == '\'' || inner[1] == '\\') {
+		return inner[1], true
+	}
+	if len(inner) == 1 && inner[0] >= ' ' && inner[0] <= '~' && inner[0] != '\'' && inner[0] != '\\' {
+		return inner[0], true
+	}
+	return 0, false
+}
+
+// Lexer splits hack assembly source into tokens.
+// Every line ends with NEWLINE token, including the last line without line ending,
+// and EOF token follows the last NEWLINE token.
+type Lexer struct {
+	reader   *bufio.Reader
+	filename string
+	// includedFrom is the position of .include which included the source, or nil
+	includedFrom *Position
+	// line is the current line without line ending
+	line       string
+	lineNumber int
+	// offset is the byte offset of next character in line.
+	// It is greater than len(line) after NEWLINE token of the line.
+	offset int
+	err    error
+	eof    bool
+}
+
+// NewLexer returns *Lexer reading source from reader. filename is used for token positions.
+func NewLexer(reader io.Reader, filename string) *Lexer {
+	return &Lexer{
+		reader:   bufio.NewReader(reader),
+		filename: filename,
+		// no line is read yet
+		offset: 1,
+	}
+}
+
+// Err returns the error of reading the source, if any.
+func (l *Lexer) Err() error {
+	return l.err
+}
+
+// Line returns the source text of the current line without line ending.
+// The current line is the line of the last token returned by Next.
+func (l *Lexer) Line() string {
+	return l.line
+}
+
+// Next returns the next token. It returns EOF token forever at the end of the source.
+func (l *Lexer) Next() Token {
+	if l.offset > len(l.line) && !l.readLine() {
+		return Token{Type: EOFToken, Pos: l.position(l.lineNumber+1, 1)}
+	}
+
+	// skip spaces. '\r' can be left by old mac line ending.
+	for l.offset < len(l.line) && (l.line[l.offset] == ' ' || l.line[l.offset] == '\t' || l.line[l.offset] == '\r') {
+		l.offset += 1
+	}
+
+	start := l.offset
+	pos := l.position(l.lineNumber, start+1)
+
+	if start == len(l.line) {
+		l.offset += 1
+		return Token{Type: NewlineToken, Text: "\n", Pos: pos}
+	}
+
+	c := l.line[start]
+	switch {
+	case strings.HasPrefix(l.line[start:], "//"):
+		l.offset = len(l.line)
+		return Token{Type: CommentToken, Text: l.line[start:], Pos: pos}
+	case isSymbolChar(c):
+		for l.offset < len(l.line) && isSymbolChar(l.line[l.offset]) {
+			l.offset += 1
+		}
+		tokenType := IdentToken
+		if isDigit(c) {
+			tokenType = NumberToken
+		}
+		return Token{Type: tokenType, Text: l.line[start:l.offset], Pos: pos}
+	}
+
+	if c == '\'' {
+		// 'A' or escaped '\'' and '\\'
+		for _, size := range []int{3, 4} {
+			if start+size <= len(l.line) {
+				if _, ok := charLiteral(l.line[start : start+size]); ok {
+					l.offset += size
+					return Token{Type: CharToken, Text: l.line[start:l.offset], Pos: pos}
+				}
+			}
+		}
+	}
+
+	if c == '"' {
+		// "math.asm" without escapes
+		if end := strings.IndexByte(l.line[start+1:], '"'); end >= 0 {
+			l.offset += end + 2
+			return Token{Type: StringToken, Text: l.line[start:l.offset], Pos: pos}
+		}
+	}
+
+	if start+2 <= len(l.line) {
+		if tokenType, ok := shifts[l.line[start:start+2]]; ok {
+			l.offset += 2
+			return Token{Type: tokenType, Text: l.line[start:l.offset], Pos: pos}
+		}
+	}
+
+	if tokenType, ok := punctuations[c]; ok {
+		l.offset += 1
+		return Token{Type: tokenType, Text: l.line[start:l.offset], Pos: pos}
+	}
+
+	_, size := utf8.DecodeRuneInString(l.line[start:])
+	l.offset += size
+	return Token{Type: IllegalToken, Text: l.line[start:l.offset], Pos: pos}
+}
+
+// readLine reads the next line. It returns false when there is no more line.
+func (l *Lexer) readLine() bool {
+	if l.eof {
+		return false
+	}
+
+	line, err := l.reader.ReadString('\n')
+	if err != nil {
+		l.eof = true
+		if err != io.EOF {
+			l.err = err
+		}
+		if line == "" {
+			return false
+		}
+	}
+
+	l.line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+	l.lineNumber += 1
+	l.offset = 0
+	return true
+}
+
+func (l *Lexer) position(line int, column int) Position {
+	return Position{File: l.filename, Line: line, Column: column, IncludedFrom: l.includedFrom}
+}
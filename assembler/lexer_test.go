@@ -0,0 +1,120 @@
+package assembler
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLexer_Next(t *testing.T) {
+	source := "@LOOP.1 // comment\r\n" +
+		"\tAM = M+1;JGT\n" +
+		"\n" +
+		"(R$2:x)\n" +
+		"D=!A&D|-1 #"
+
+	tests := []Token{
+		{Type: AtToken, Text: "@", Pos: Position{File: "Foo.asm", Line: 1, Column: 1}},
+		{Type: IdentToken, Text: "LOOP.1", Pos: Position{File: "Foo.asm", Line: 1, Column: 2}},
+		{Type: CommentToken, Text: "// comment", Pos: Position{File: "Foo.asm", Line: 1, Column: 9}},
+		{Type: NewlineToken, Text: "\n", Pos: Position{File: "Foo.asm", Line: 1, Column: 19}},
+		{Type: IdentToken, Text: "AM", Pos: Position{File: "Foo.asm", Line: 2, Column: 2}},
+		{Type: AssignToken, Text: "=", Pos: Position{File: "Foo.asm", Line: 2, Column: 5}},
+		{Type: IdentToken, Text: "M", Pos: Position{File: "Foo.asm", Line: 2, Column: 7}},
+		{Type: PlusToken, Text: "+", Pos: Position{File: "Foo.asm", Line: 2, Column: 8}},
+		{Type: NumberToken, Text: "1", Pos: Position{File: "Foo.asm", Line: 2, Column: 9}},
+		{Type: SemicolonToken, Text: ";", Pos: Position{File: "Foo.asm", Line: 2, Column: 10}},
+		{Type: IdentToken, Text: "JGT", Pos: Position{File: "Foo.asm", Line: 2, Column: 11}},
+		{Type: NewlineToken, Text: "\n", Pos: Position{File: "Foo.asm", Line: 2, Column: 14}},
+		{Type: NewlineToken, Text: "\n", Pos: Position{File: "Foo.asm", Line: 3, Column: 1}},
+		{Type: LParenToken, Text: "(", Pos: Position{File: "Foo.asm", Line: 4, Column: 1}},
+		{Type: IdentToken, Text: "R$2:x", Pos: Position{File: "Foo.asm", Line: 4, Column: 2}},
+		{Type: RParenToken, Text: ")", Pos: Position{File: "Foo.asm", Line: 4, Column: 7}},
+		{Type: NewlineToken, Text: "\n", Pos: Position{File: "Foo.asm", Line: 4, Column: 8}},
+		{Type: IdentToken, Text: "D", Pos: Position{File: "Foo.asm", Line: 5, Column: 1}},
+		{Type: AssignToken, Text: "=", Pos: Position{File: "Foo.asm", Line: 5, Column: 2}},
+		{Type: NotToken, Text: "!", Pos: Position{File: "Foo.asm", Line: 5, Column: 3}},
+		{Type: IdentToken, Text: "A", Pos: Position{File: "Foo.asm", Line: 5, Column: 4}},
+		{Type: AndToken, Text: "&", Pos: Position{File: "Foo.asm", Line: 5, Column: 5}},
+		{Type: IdentToken, Text: "D", Pos: Position{File: "Foo.asm", Line: 5, Column: 6}},
+		{Type: OrToken, Text: "|", Pos: Position{File: "Foo.asm", Line: 5, Column: 7}},
+		{Type: MinusToken, Text: "-", Pos: Position{File: "Foo.asm", Line: 5, Column: 8}},
+		{Type: NumberToken, Text: "1", Pos: Position{File: "Foo.asm", Line: 5, Column: 9}},
+		{Type: IllegalToken, Text: "#", Pos: Position{File: "Foo.asm", Line: 5, Column: 11}},
+		{Type: NewlineToken, Text: "\n", Pos: Position{File: "Foo.asm", Line: 5, Column: 12}},
+		{Type: EOFToken, Text: "", Pos: Position{File: "Foo.asm", Line: 6, Column: 1}},
+		{Type: EOFToken, Text: "", Pos: Position{File: "Foo.asm", Line: 6, Column: 1}},
+	}
+
+	lexer := NewLexer(strings.NewReader(source), "Foo.asm")
+	for i, wanted := range tests {
+		if got := lexer.Next(); got != wanted {
+			t.Errorf("Next() #%d = %+v, want %+v", i, got, wanted)
+		}
+	}
+	if err := lexer.Err(); err != nil {
+		t.Errorf("Err() = %s, want nil", err)
+	}
+}
+
+func TestLexer_Next_number(t *testing.T) {
+	tests := []struct {
+		source    string
+		tokenType TokenType
+		text      string
+	}{
+		{source: "100", tokenType: NumberToken, text: "100"},
+		{source: "1abc", tokenType: NumberToken, text: "1abc"},
+		{source: "abc1", tokenType: IdentToken, text: "abc1"},
+		{source: "_x", tokenType: IdentToken, text: "_x"},
+		{source: "é", tokenType: IllegalToken, text: "é"},
+		{source: "*2", tokenType: StarToken, text: "*"},
+		{source: "/2", tokenType: SlashToken, text: "/"},
+		{source: "%2", tokenType: PercentToken, text: "%"},
+		{source: "<<2", tokenType: ShlToken, text: "<<"},
+		{source: ">>2", tokenType: ShrToken, text: ">>"},
+		{source: "<2", tokenType: IllegalToken, text: "<"},
+		{source: "0x4000", tokenType: NumberToken, text: "0x4000"},
+		{source: "'A'", tokenType: CharToken, text: "'A'"},
+		{source: "' '", tokenType: CharToken, text: "' '"},
+		{source: `'\''`, tokenType: CharToken, text: `'\''`},
+		{source: `'\\'`, tokenType: CharToken, text: `'\\'`},
+		{source: "'''", tokenType: IllegalToken, text: "'"},
+		{source: "'AB'", tokenType: IllegalToken, text: "'"},
+		{source: "'A", tokenType: IllegalToken, text: "'"},
+		{source: "//2", tokenType: CommentToken, text: "//2"},
+		{source: `"math.asm" x`, tokenType: StringToken, text: `"math.asm"`},
+		{source: `"" x`, tokenType: StringToken, text: `""`},
+		{source: `"math.asm`, tokenType: IllegalToken, text: `"`},
+	}
+
+	for _, test := range tests {
+		got := NewLexer(strings.NewReader(test.source), "").Next()
+		if got.Type != test.tokenType || got.Text != test.text {
+			t.Errorf("Next() = %s %q, want %s %q", got.Type, got.Text, test.tokenType, test.text)
+		}
+	}
+}
+
+func TestLexer_Line(t *testing.T) {
+	lexer := NewLexer(strings.NewReader("@i // comment\r\nD=M"), "")
+
+	wanted := []string{"@i // comment", "@i // comment", "@i // comment", "@i // comment", "D=M"}
+	for _, line := range wanted {
+		lexer.Next()
+		if got := lexer.Line(); got != line {
+			t.Errorf("Line() = %q, want %q", got, line)
+		}
+	}
+}
+
+func TestLexer_Err(t *testing.T) {
+	lexer := NewLexer(&errReader{data: "@i\n", err: errors.New("disk failure")}, "")
+
+	for lexer.Next().Type != EOFToken {
+	}
+
+	if lexer.Err() == nil {
+		t.Errorf("Err() should not be nil")
+	}
+}
@@ -0,0 +1,84 @@
+package assembler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writeListing writes the listing of the program to writer: ROM address, machine code in binary and hex,
+// line number and source line of every source line, followed by the symbol table.
+// words are the machine code of A and C commands of parser in order.
+func writeListing(writer io.Writer, source string, parser *Parser, words []uint16) error {
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	// commands by source line with their ROM addresses. Macro expansions are on the line of the invocation
+	// and included files are on the line of .include.
+	type addressedCommand struct {
+		command Command
+		addr    int
+	}
+	commands := map[int][]addressedCommand{}
+	addr := 0
+	for _, command := range parser.Commands {
+		line := command.Pos.Main().Line
+		commands[line] = append(commands[line], addressedCommand{command, addr})
+		if command.CommandType == ACommand || command.CommandType == CCommand {
+			addr += 1
+		}
+	}
+
+	buffered := bufio.NewWriter(writer)
+	printLine := func(format string, a ...interface{}) {
+		fmt.Fprintln(buffered, strings.TrimRight(fmt.Sprintf(format, a...), " "))
+	}
+
+	printLine("%5s  %-16s  %-4s  %4s  %s", "ROM", "BINARY", "HEX", "LINE", "SOURCE")
+	for i, text := range lines {
+		lineNumber := i + 1
+		lineCommands := commands[lineNumber]
+		if len(lineCommands) == 0 || lineCommands[0].command.Pos.Main() != lineCommands[0].command.Pos {
+			// macro invocation and .include are shown before the commands from them
+			printLine("%5s  %16s  %4s  %4d  %s", "", "", "", lineNumber, text)
+		}
+		for j, c := range lineCommands {
+			source := text
+			pos := c.command.Pos.Source()
+			switch depth := expansionDepth(c.command.Pos); {
+			case depth > 0:
+				// expanded commands are marked by + for each level of expansion
+				source = strings.Repeat("+", depth) + " " + c.command.Text
+			case pos.IncludedFrom != nil:
+				source = c.command.Text
+			case j > 0:
+				// source line is shown once
+				source = ""
+			}
+			if pos.IncludedFrom != nil {
+				// commands of included files are shown with their file and line
+				source = fmt.Sprintf("%s:%d: %s", pos.File, pos.Line, source)
+			}
+			if c.command.CommandType == LCommand {
+				printLine("%5d  %16s  %4s  %4d  %s", c.addr, "", "", lineNumber, source)
+				continue
+			}
+			if c.command.CommandType == EquCommand {
+				// constants have no ROM address
+				printLine("%5s  %16s  %4s  %4d  %s", "", "", "", lineNumber, source)
+				continue
+			}
+			word := words[c.addr]
+			printLine("%5d  %016b  %04X  %4d  %s", c.addr, word, word, lineNumber, source)
+		}
+	}
+
+	fmt.Fprintln(buffered)
+	if err := WriteSymbolMap(buffered, parser.Symbols()); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
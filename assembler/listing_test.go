@@ -0,0 +1,90 @@
+package assembler
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestAssembler_WriteBinaryCode_listing(t *testing.T) {
+	reader := strings.NewReader("// counts down\r\n.equ N 3\r\n@N\r\nD=A\r\n(LOOP)\r\n\t@count\r\n\tMD=D-1 // count\r\n@LOOP\r\nD;JGT\r\n")
+	listing := new(bytes.Buffer)
+	assembler := New(reader, ioutil.Discard)
+	assembler.Listing = listing
+	if err := assembler.WriteBinaryCode(); err != nil {
+		t.Fatalf("assembler.WriteBinaryCode() results in error: %s", err)
+	}
+
+	wanted := `  ROM  BINARY            HEX   LINE  SOURCE
+                                  1  // counts down
+                                  2  .equ N 3
+    0  0000000000000011  0003     3  @N
+    1  1110110000010000  EC10     4  D=A
+    2                             5  (LOOP)
+    2  0000000000010000  0010     6  	@count
+    3  1110001110011000  E398     7  	MD=D-1 // count
+    4  0000000000000010  0002     8  @LOOP
+    5  1110001100000001  E301     9  D;JGT
+
+SYMBOL  KIND        ADDRESS  USES
+LOOP    label             2  1
+N       constant          3  1
+count   variable         16  1
+`
+	if got := listing.String(); got != wanted {
+		t.Errorf("listing =\n%s\nwant\n%s", got, wanted)
+	}
+}
+
+func TestAssembler_WriteBinaryCode_listingMacro(t *testing.T) {
+	reader := strings.NewReader(".macro SET var, value\n@value\nD=A\n@var\nM=D\n.endm\n.macro WAIT\n(LOOP)\nSET n, 1\n@LOOP\n0;JMP\n.endm\nWAIT // forever\n")
+	listing := new(bytes.Buffer)
+	assembler := New(reader, ioutil.Discard)
+	assembler.Listing = listing
+	if err := assembler.WriteBinaryCode(); err != nil {
+		t.Fatalf("assembler.WriteBinaryCode() results in error: %s", err)
+	}
+
+	wanted := `  ROM  BINARY            HEX   LINE  SOURCE
+                                  1  .macro SET var, value
+                                  2  @value
+                                  3  D=A
+                                  4  @var
+                                  5  M=D
+                                  6  .endm
+                                  7  .macro WAIT
+                                  8  (LOOP)
+                                  9  SET n, 1
+                                 10  @LOOP
+                                 11  0;JMP
+                                 12  .endm
+                                 13  WAIT // forever
+    0                            13  + (WAIT.1$LOOP)
+    0  0000000000000001  0001    13  ++ @1
+    1  1110110000010000  EC10    13  ++ D=A
+    2  0000000000010000  0010    13  ++ @n
+    3  1110001100001000  E308    13  ++ M=D
+    4  0000000000000000  0000    13  + @WAIT.1$LOOP
+    5  1110101010000111  EA87    13  + 0;JMP
+
+SYMBOL       KIND        ADDRESS  USES
+WAIT.1$LOOP  label             0  1
+n            variable         16  1
+`
+	if got := listing.String(); got != wanted {
+		t.Errorf("listing =\n%s\nwant\n%s", got, wanted)
+	}
+}
+
+func TestAssembler_WriteBinaryCode_listingError(t *testing.T) {
+	listing := new(bytes.Buffer)
+	assembler := New(strings.NewReader("D=X\n"), ioutil.Discard)
+	assembler.Listing = listing
+	if err := assembler.WriteBinaryCode(); err == nil {
+		t.Fatalf("assembler.WriteBinaryCode() should return error")
+	}
+	if listing.Len() != 0 {
+		t.Errorf("listing = %q, should be empty on error", listing)
+	}
+}
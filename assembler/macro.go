@@ -0,0 +1,198 @@
+package assembler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// macroDirective and endmDirective define a macro with parameters, e.g.
+//
+//	.macro PUSH value
+//	@value
+//	D=A
+//	...
+//	.endm
+//
+// and the macro is invoked as "PUSH 7". Parameters are separated by ",".
+const (
+	macroDirective = ".macro"
+	endmDirective  = ".endm"
+)
+
+// maxExpansionDepth limits macro invocations in macro bodies to stop recursive macros.
+const maxExpansionDepth = 64
+
+// sourceLine is the tokens of a line without comment and NEWLINE.
+type sourceLine struct {
+	tokens []Token
+	// text is the source text from the first token to the last token
+	text string
+	pos  Position
+}
+
+// macro is a macro defined by .macro and .endm.
+type macro struct {
+	name   string
+	params []string
+	pos    Position
+	body   []sourceLine
+	// valid is false when .macro line has an error. The body is read but the macro is not defined.
+	valid bool
+	// expansions is the number of expansions, which makes names of local labels unique
+	expansions int
+}
+
+// isDirective reports whether the line starts with directive.
+func (l sourceLine) isDirective(directive string) bool {
+	return l.tokens[0].Type == IdentToken && l.tokens[0].Text == directive
+}
+
+// beginMacro starts the definition of macro by ".macro NAME param1, param2".
+// The body is read until .endm even when the line has an error.
+func (p *Parser) beginMacro(line sourceLine) *Diagnostic {
+	m := &macro{pos: line.pos}
+	p.defining = m
+
+	tokens := line.tokens[1:]
+	if len(tokens) == 0 {
+		return newDiagnostic(line.pos, "missing macro name after %s", macroDirective)
+	}
+	if tokens[0].Type != IdentToken {
+		return newDiagnostic(tokens[0].Pos, "unexpected %s, expected macro name", tokens[0])
+	}
+	m.name = tokens[0].Text
+	if strings.HasPrefix(m.name, ".") {
+		return newDiagnostic(tokens[0].Pos, "macro %q must not start with \".\"", m.name)
+	}
+	if _, ok := compToBits[m.name]; ok {
+		return newDiagnostic(tokens[0].Pos, "macro %q conflicts with comp", m.name)
+	}
+	if _, ok := destToBits[m.name]; ok {
+		return newDiagnostic(tokens[0].Pos, "macro %q conflicts with dest", m.name)
+	}
+	if _, ok := jumpToBits[m.name]; ok {
+		return newDiagnostic(tokens[0].Pos, "macro %q conflicts with jump", m.name)
+	}
+	if defined, ok := p.macros[m.name]; ok {
+		return newDiagnostic(tokens[0].Pos, "macro %q already defined at %s", m.name, defined.pos)
+	}
+
+	args := splitArgs(tokens[1:])
+	for _, arg := range args {
+		if len(arg) == 0 {
+			return newDiagnostic(line.pos, "missing parameter name in %q", line.text)
+		}
+		if arg[0].Type != IdentToken {
+			return newDiagnostic(arg[0].Pos, "unexpected %s, expected parameter name", arg[0])
+		}
+		if len(arg) > 1 {
+			return newDiagnostic(arg[1].Pos, "unexpected %s after parameter %q", arg[1], arg[0].Text)
+		}
+		for _, param := range m.params {
+			if param == arg[0].Text {
+				return newDiagnostic(arg[0].Pos, "parameter %q already declared", param)
+			}
+		}
+		m.params = append(m.params, arg[0].Text)
+	}
+	m.valid = true
+	return nil
+}
+
+// endMacro ends the definition of macro by .endm.
+func (p *Parser) endMacro(line sourceLine) *Diagnostic {
+	m := p.defining
+	p.defining = nil
+	if m.valid {
+		p.macros[m.name] = m
+	}
+	if len(line.tokens) > 1 {
+		return newDiagnostic(line.tokens[1].Pos, "unexpected %s after %s", line.tokens[1], endmDirective)
+	}
+	return nil
+}
+
+// expandMacro expands the invocation of m in line to the lines of the body with arguments.
+// Labels declared in the body are renamed to NAME.N$label for the Nth expansion,
+// so the macro can be expanded many times.
+func (p *Parser) expandMacro(m *macro, line sourceLine) *Diagnostic {
+	if expansionDepth(line.pos) >= maxExpansionDepth {
+		return newDiagnostic(line.pos, "expansion of macro %q is too deep", m.name)
+	}
+
+	args := splitArgs(line.tokens[1:])
+	if len(args) != len(m.params) {
+		return newDiagnostic(line.pos, "macro %q takes %d arguments, but %d given", m.name, len(m.params), len(args))
+	}
+	values := map[string][]Token{}
+	for i, arg := range args {
+		if len(arg) == 0 {
+			return newDiagnostic(line.pos, "missing argument %q of macro %q", m.params[i], m.name)
+		}
+		values[m.params[i]] = arg
+	}
+
+	locals := map[string]bool{}
+	for _, body := range m.body {
+		if len(body.tokens) > 1 && body.tokens[0].Type == LParenToken && body.tokens[1].Type == IdentToken {
+			locals[body.tokens[1].Text] = true
+		}
+	}
+
+	m.expansions += 1
+	expansion := &Expansion{Macro: m.name, Pos: line.pos}
+	var lines []sourceLine
+	for _, body := range m.body {
+		expanded := sourceLine{pos: body.pos}
+		expanded.pos.Expansion = expansion
+		var text strings.Builder
+		end := 0
+		for _, token := range body.tokens {
+			// spaces between tokens are kept
+			start := token.Pos.Column - body.pos.Column
+			text.WriteString(body.text[end:start])
+			end = start + len(token.Text)
+
+			if arg, ok := values[token.Text]; ok && token.Type == IdentToken {
+				expanded.tokens = append(expanded.tokens, arg...)
+				text.WriteString(joinTokens(arg))
+				continue
+			}
+			if locals[token.Text] && token.Type == IdentToken {
+				token.Text = fmt.Sprintf("%s.%d$%s", m.name, m.expansions, token.Text)
+			}
+			token.Pos.Expansion = expansion
+			expanded.tokens = append(expanded.tokens, token)
+			text.WriteString(token.Text)
+		}
+		expanded.text = text.String()
+		lines = append(lines, expanded)
+	}
+	p.expanded = append(lines, p.expanded...)
+	return nil
+}
+
+// expansionDepth returns the number of macro expansions of pos.
+func expansionDepth(pos Position) int {
+	depth := 0
+	for ; pos.Expansion != nil; pos = pos.Expansion.Pos {
+		depth += 1
+	}
+	return depth
+}
+
+// splitArgs splits tokens by ",". It returns nil for no tokens.
+func splitArgs(tokens []Token) [][]Token {
+	if len(tokens) == 0 {
+		return nil
+	}
+	args := [][]Token{{}}
+	for _, token := range tokens {
+		if token.Type == CommaToken {
+			args = append(args, []Token{})
+			continue
+		}
+		args[len(args)-1] = append(args[len(args)-1], token)
+	}
+	return args
+}
@@ -0,0 +1,147 @@
+package assembler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const macroProgram = `.macro PUSH value
+  @value
+  D=A
+  @SP
+  AM=M+1
+  A=A-1
+  M=D
+.endm
+.macro WAIT
+(LOOP)
+  @LOOP
+  0;JMP
+.endm
+.macro PUSH2 a, b
+  PUSH a
+  PUSH b+1
+.endm
+PUSH 7
+PUSH2 1, SCREEN
+(END)
+WAIT
+WAIT
+@END
+`
+
+func TestParser_Parse_macro(t *testing.T) {
+	parser := NewParser(strings.NewReader(macroProgram))
+	parser.Filename = "Foo.asm"
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("parser.Parse() results in error: %s", err)
+	}
+
+	var got []string
+	for _, command := range parser.Commands {
+		got = append(got, command.String())
+	}
+	push := func(value string) []string {
+		return []string{"@" + value, "D=A", "@SP", "AM=M+1", "A=A-1", "M=D"}
+	}
+	var wanted []string
+	wanted = append(wanted, push("7")...)
+	wanted = append(wanted, push("1")...)
+	wanted = append(wanted, push("SCREEN+1")...)
+	wanted = append(wanted, "(END)", "(WAIT.1$LOOP)", "@WAIT.1$LOOP", "0;JMP", "(WAIT.2$LOOP)", "@WAIT.2$LOOP", "0;JMP", "@END")
+	if !reflect.DeepEqual(got, wanted) {
+		t.Errorf("parser.Commands = %v, want %v", got, wanted)
+	}
+
+	// labels have addresses of the expanded code
+	for name, wanted := range map[string]uint16{"END": 18, "WAIT.1$LOOP": 18, "WAIT.2$LOOP": 20} {
+		if addr, ok := parser.LookupSymbol(name); !ok || addr != wanted {
+			t.Errorf("parser.LookupSymbol(%s) = %d, %t, want %d", name, addr, ok, wanted)
+		}
+	}
+
+	// @b+1 in PUSH2 at line 16 is expanded from @value in PUSH at line 2
+	command := parser.Commands[12]
+	if command.Text != "@SCREEN+1" || command.Pos.Line != 2 || command.Pos.Column != 3 {
+		t.Errorf("parser.Commands[12] = %+v, want @SCREEN+1 at 2:3", command)
+	}
+	expansion := command.Pos.Expansion
+	if expansion == nil || expansion.Macro != "PUSH" || expansion.Pos.Line != 16 ||
+		expansion.Pos.Expansion == nil || expansion.Pos.Expansion.Macro != "PUSH2" || expansion.Pos.Expansion.Pos.Line != 19 {
+		t.Errorf("parser.Commands[12].Pos.Expansion = %+v, want PUSH at 16 in PUSH2 at 19", expansion)
+	}
+	if source := command.Pos.Source(); source.Line != 19 || source.Expansion != nil {
+		t.Errorf("parser.Commands[12].Pos.Source() = %+v, want line 19", source)
+	}
+}
+
+func TestParser_Parse_macroError(t *testing.T) {
+	tests := []struct {
+		source string
+		wanted string
+	}{
+		{
+			source: ".macro SET value\nD=value;\n.endm\n@1\nSET X\n",
+			wanted: `Foo.asm:2:9: missing jump after ";" (in expansion of SET at Foo.asm:5)`,
+		},
+		{
+			source: ".macro SET value\nD=value;\n.endm\n.macro SET2\nSET X\n.endm\nSET2\n",
+			wanted: `Foo.asm:2:9: missing jump after ";" (in expansion of SET at Foo.asm:5, in expansion of SET2 at Foo.asm:7)`,
+		},
+		{
+			source: ".macro JUMP\n@L\n0;JMP\n.endm\n(l)\nJUMP\n",
+			wanted: "Foo.asm:2:1: warning: variable \"L\" differs from label \"l\" only by case, declared at Foo.asm:5:1 (in expansion of JUMP at Foo.asm:6)",
+		},
+		{source: ".macro\n.endm\n", wanted: `Foo.asm:1:1: missing macro name after .macro`},
+		{source: ".macro 1M\n.endm\n", wanted: `Foo.asm:1:8: unexpected "1M", expected macro name`},
+		{source: ".macro .M\n.endm\n", wanted: `Foo.asm:1:8: macro ".M" must not start with "."`},
+		{source: ".macro AM\n.endm\n", wanted: `Foo.asm:1:8: macro "AM" conflicts with dest`},
+		{source: ".macro D\n.endm\n", wanted: `Foo.asm:1:8: macro "D" conflicts with comp`},
+		{source: ".macro JMP\n.endm\n", wanted: `Foo.asm:1:8: macro "JMP" conflicts with jump`},
+		{source: ".macro M1\n.endm\n.macro M1\n.endm\n", wanted: `Foo.asm:3:8: macro "M1" already defined at Foo.asm:1:1`},
+		{source: ".macro M1 a,\n.endm\n", wanted: `Foo.asm:1:1: missing parameter name in ".macro M1 a,"`},
+		{source: ".macro M1 a b\n.endm\n", wanted: `Foo.asm:1:13: unexpected "b" after parameter "a"`},
+		{source: ".macro M1 1\n.endm\n", wanted: `Foo.asm:1:11: unexpected "1", expected parameter name`},
+		{source: ".macro M1 a, a\n.endm\n", wanted: `Foo.asm:1:14: parameter "a" already declared`},
+		{source: ".macro M1\n@1\n", wanted: `Foo.asm:1:1: missing .endm of macro "M1"`},
+		{source: ".macro M1\n.macro M2\n.endm\n", wanted: `Foo.asm:2:1: .macro in macro "M1"`},
+		{source: ".endm\n", wanted: `Foo.asm:1:1: .endm without .macro`},
+		{source: ".macro M1\n.endm M1\n", wanted: `Foo.asm:2:7: unexpected "M1" after .endm`},
+		{source: ".macro M1 a\n.endm\nM1\n", wanted: `Foo.asm:3:1: macro "M1" takes 1 arguments, but 0 given`},
+		{source: ".macro M1 a, b\n.endm\nM1 1,\n", wanted: `Foo.asm:3:1: missing argument "b" of macro "M1"`},
+		{
+			source: ".macro M1\nM1\n.endm\nM1\n",
+			wanted: `Foo.asm:2:1: expansion of macro "M1" is too deep (in expansion of M1 at Foo.asm:2, 62 more, in expansion of M1 at Foo.asm:4)`,
+		},
+	}
+	for _, test := range tests {
+		parser := NewParser(strings.NewReader(test.source))
+		parser.Filename = "Foo.asm"
+		err := parser.Parse()
+		if strings.Contains(test.wanted, "warning") {
+			if err != nil || len(parser.Diagnostics) != 1 {
+				t.Errorf("parser.Parse() = %v, diagnostics %v, want a warning for %q", err, parser.Diagnostics, test.source)
+				continue
+			}
+			err = parser.Diagnostics[0]
+		}
+		if err == nil {
+			t.Errorf("parser.Parse() should return error for %q", test.source)
+			continue
+		}
+		if got := strings.SplitN(err.Error(), "\n", 2)[0]; !strings.HasPrefix(got, test.wanted) {
+			t.Errorf("parser.Parse() error = %s, want %s", got, test.wanted)
+		}
+	}
+}
+
+func TestAssembler_WriteBinaryCode_macroError(t *testing.T) {
+	assembler := New(strings.NewReader(".macro SET value\nD=value\n.endm\n@1\nSET X\n"), new(strings.Builder))
+	assembler.Filename = "Foo.asm"
+	err := assembler.WriteBinaryCode()
+	wanted := `Foo.asm:2:1: unknown comp "X" (in expansion of SET at Foo.asm:5)`
+	if err == nil || err.Error() != wanted {
+		t.Errorf("assembler.WriteBinaryCode() error = %v, want %s", err, wanted)
+	}
+}
@@ -0,0 +1,18 @@
+package assembler
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// OSFS is the file system of the operating system. Files are opened by their paths
+// in slash form, relative to the working directory or absolute, so .include can refer
+// to files in any directory like the paths on the command line.
+var OSFS fs.FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(filepath.FromSlash(name))
+}
@@ -1,10 +1,8 @@
 package assembler
 
 import (
-	"bufio"
-	"errors"
-	"fmt"
 	"io"
+	"io/fs"
 	"strconv"
 	"strings"
 )
@@ -12,44 +10,93 @@ import (
 // Parser parses hack assembly program codes.
 type Parser struct {
 	Commands []Command
-	scanner *bufio.Scanner
-	currentCommand string
+	// Filename is used for the positions of commands and diagnostics
+	Filename string
+	// Recover makes Parse continue after errors and collect all of them in Diagnostics
+	Recover bool
+	// MaxErrors keeps the first errors of the program in recover mode, and the rest are
+	// reported as too many errors. 0 means no limit.
+	MaxErrors int
+	// Diagnostics has all errors and warnings found by Parse
+	Diagnostics Diagnostics
+	// FS has the files of .include. Files are named by Filename and paths of FS.
+	FS fs.FS
+	// IncludePath is the directories in FS where .include searches files after the directory of the including file
+	IncludePath []string
+	reader io.Reader
+	// lexer reads the current file
+	lexer *Lexer
+	// includes are lexers of the files which included the current file, from the main file
+	includes []*Lexer
+	// currentTokens are tokens of current command without comment and NEWLINE
+	currentTokens []Token
+	currentText string
+	currentPos Position
+	// currentOrigin is given by the last "//# source" comment
+	currentOrigin Position
+	// currentErr is the error of current line found by Advance. ParseOne returns it.
+	currentErr *Diagnostic
+	// macros are macros defined by .macro
+	macros map[string]*macro
+	// defining is the macro of which body is being read
+	defining *macro
+	// expanded are lines of macro expansions which are read before the next source line
+	expanded []sourceLine
 	currentRAMAddr uint16
 	currentROMAddr uint16
 	symbolTable map[string]uint16
+	// labels has positions of label declarations
+	labels map[string]Position
+	// constants has positions of constant definitions
+	constants map[string]Position
+	err error
+	// stopped is true when parsing ended before all commands are processed
+	stopped bool
+}
+
+// predefinedSymbols are symbols of hack assembly which every program can use.
+var predefinedSymbols = map[string]uint16{
+	"SP":     0,
+	"LCL":    1,
+	"ARG":    2,
+	"THIS":   3,
+	"THAT":   4,
+	"R0":     0,
+	"R1":     1,
+	"R2":     2,
+	"R3":     3,
+	"R4":     4,
+	"R5":     5,
+	"R6":     6,
+	"R7":     7,
+	"R8":     8,
+	"R9":     9,
+	"R10":    10,
+	"R11":    11,
+	"R12":    12,
+	"R13":    13,
+	"R14":    14,
+	"R15":    15,
+	"SCREEN": 16384,
+	"KBD":    24576,
+}
+
+// PredefinedSymbols returns predefined symbols of hack assembly with their addresses.
+func PredefinedSymbols() map[string]uint16 {
+	symbols := make(map[string]uint16, len(predefinedSymbols))
+	for symbol, addr := range predefinedSymbols {
+		symbols[symbol] = addr
+	}
+	return symbols
 }
 
 // NewParser returns *Parser object which has commands
 func NewParser(reader io.Reader) *Parser {
 	parser := &Parser{}
-	parser.scanner = bufio.NewScanner(reader)
+	parser.reader = reader
 
 	// initializing symbolTable for predefined symbols
-	parser.symbolTable = map[string]uint16 {
-		"SP": 0,
-		"LCL": 1,
-		"ARG": 2,
-		"THIS": 3,
-		"THAT": 4,
-		"R0": 0,
-		"R1": 1,
-		"R2": 2,
-		"R3": 3,
-		"R4": 4,
-		"R5": 5,
-		"R6": 6,
-		"R7": 7,
-		"R8": 8,
-		"R9": 9,
-		"R10": 10,
-		"R11": 11,
-		"R12": 12,
-		"R13": 13,
-		"R14": 14,
-		"R15": 15,
-		"SCREEN": 16384,
-		"KBD": 24576,
-	}
+	parser.symbolTable = PredefinedSymbols()
 
 	// initialize ROM Addr counter
 	parser.currentROMAddr = 0
@@ -59,105 +106,490 @@ func NewParser(reader io.Reader) *Parser {
 
 	parser.Commands = []Command{}
 
+	parser.macros = map[string]*macro{}
+
 	return parser
 }
 
-// Parse parses all hack assembly program codes to Command structs
+// Parse parses all hack assembly program codes to Command structs.
+// It returns the first *Diagnostic as error. In recover mode, it parses the whole program
+// and returns Diagnostics as error when any error is found.
 func (p *Parser) Parse() error {
-	p.parseToCommands()
+	if err := p.parseToCommands(); err != nil {
+		return err
+	}
 	if err := p.fillSymbolTable(); err != nil {
 		return err
 	}
-	p.parseACommandSymbolToInt()
-	return nil
+	if err := p.parseACommandSymbolToInt(); err != nil {
+		return err
+	}
+	return p.finish()
 }
 
-func (p *Parser) parseToCommands() {
+func (p *Parser) parseToCommands() error {
 	for p.Advance() {
-		p.Commands = append(p.Commands, p.ParseOne())
+		command, err := p.ParseOne()
+		if err != nil {
+			if err := p.report(err.(*Diagnostic)); err != nil {
+				return err
+			}
+			continue
+		}
+		if command.CommandType == ACommand && strings.HasPrefix(command.Symbol, "-") {
+			commands, err := expandNegative(command)
+			if err != nil {
+				if err := p.report(err.(*Diagnostic)); err != nil {
+					return err
+				}
+				continue
+			}
+			p.Commands = append(p.Commands, commands...)
+			continue
+		}
+		p.Commands = append(p.Commands, command)
+	}
+	if err := p.Err(); err != nil {
+		// reading can not continue after failure even in recover mode
+		p.stopped = true
+		if err := p.report(err.(*Diagnostic)); err != nil {
+			return err
+		}
+		return p.finish()
+	}
+	return nil
+}
+
+// expandNegative expands "@-N" of a literal N into "@N-1" and "A=!A", because -N is !(N-1)
+// in 16 bits two's complement and A command can have only 15 bits value.
+// Other A commands are returned as they are.
+func expandNegative(command Command) ([]Command, error) {
+	literal := command.Symbol[1:]
+	value, ok := parseNumber(literal)
+	if _, isChar := charLiteral(literal); !isChar && !isNumber(literal) {
+		// expression like -1+2
+		return []Command{command}, nil
+	}
+	if value == 0 {
+		command.Symbol = "0"
+		return []Command{command}, nil
+	}
+
+	var bits string
+	converter, err := NewIntToBitsConverter(strconv.FormatInt(-value, 10), 16, false)
+	if ok && err == nil {
+		bits, err = converter.ToBits()
 	}
+	if !ok || err != nil {
+		return nil, newDiagnostic(command.Pos, "A command value %s is not between -32768 and 32767", command.Symbol)
+	}
+	// bits of -N are not bits of N-1
+	notBits, err := converter.not(bits)
+	var n uint64
+	if err == nil {
+		n, err = strconv.ParseUint(notBits, 2, 16)
+	}
+	if err != nil {
+		return nil, newDiagnostic(command.Pos, "A command value %s: %s", command.Symbol, err)
+	}
+
+	command.Symbol = strconv.FormatUint(n, 10)
+	not := Command{
+		CommandType: CCommand,
+		Dest:        "A",
+		Comp:        "!A",
+		Pos:         command.Pos,
+		Text:        command.Text,
+		Origin:      command.Origin,
+	}
+	return []Command{command, not}, nil
+}
+
+// report adds d to Diagnostics and returns non nil error when parsing should stop.
+func (p *Parser) report(d *Diagnostic) error {
+	p.Diagnostics = append(p.Diagnostics, d)
+	if d.Severity != SeverityError {
+		return nil
+	}
+	if !p.Recover {
+		p.stopped = true
+		return d
+	}
+	return nil
+}
+
+// finish returns collected errors in recover mode after all commands are processed.
+// Diagnostics after the first MaxErrors errors by position are dropped.
+func (p *Parser) finish() error {
+	p.Diagnostics.sort()
+	if p.MaxErrors > 0 && p.Diagnostics.ErrorCount() > p.MaxErrors {
+		count := 0
+		for i, d := range p.Diagnostics {
+			if d.Severity != SeverityError {
+				continue
+			}
+			count++
+			if count == p.MaxErrors {
+				p.Diagnostics = append(p.Diagnostics[:i+1], newDiagnostic(d.Pos, "too many errors"))
+				break
+			}
+		}
+	}
+	return p.Diagnostics.Err()
 }
 
 func (p *Parser) fillSymbolTable() error {
 	// check LCommand's symbol exists in predefined symbol.
-	// If exists, returns error
+	// If exists, reports error
 	for _, command := range p.Commands {
 		if command.CommandType == LCommand {
 			if _, ok := p.symbolTable[command.Symbol]; ok {
-				return errors.New(fmt.Sprintf("%s label already exists in predefined symbol", command.Symbol))
+				err := p.report(newDiagnostic(command.Pos, "label %q conflicts with predefined symbol", command.Symbol))
+				if err != nil {
+					return err
+				}
 			}
 		}
 	}
 
 	// fill SymbolTable with label and ROM address
-	// TODO: check when LCommand has same label -> parse error
+	p.labels = map[string]Position{}
 	for _, command := range p.Commands {
 		if command.CommandType == LCommand {
+			if pos, ok := p.labels[command.Symbol]; ok {
+				err := p.report(newDiagnostic(command.Pos, "label %q already declared at %s", command.Symbol, pos))
+				if err != nil {
+					return err
+				}
+				continue
+			}
 			if _, ok := p.symbolTable[command.Symbol]; !ok {
 				p.symbolTable[command.Symbol] = p.currentROMAddr
+				p.labels[command.Symbol] = command.Pos
 			}
 		}
 		if command.CommandType == CCommand || command.CommandType == ACommand {
 			p.currentROMAddr += 1
 		}
 	}
+
+	return p.fillConstants()
+}
+
+// fillConstants fills SymbolTable with constants in order of definition.
+// The value of a constant is a decimal number, a predefined symbol, a label or a constant defined before.
+func (p *Parser) fillConstants() error {
+	_, max, err := bitsMinMax(15, true)
+	if err != nil {
+		return err
+	}
+
+	p.constants = map[string]Position{}
+	for i, command := range p.Commands {
+		if command.CommandType != EquCommand {
+			continue
+		}
+		name := command.Symbol
+		var diagnostic *Diagnostic
+		if pos, ok := p.constants[name]; ok {
+			diagnostic = newDiagnostic(command.Pos, "constant %q already defined at %s", name, pos)
+		} else if pos, ok := p.labels[name]; ok {
+			diagnostic = newDiagnostic(command.Pos, "constant %q conflicts with label declared at %s", name, pos)
+		} else if _, ok := p.symbolTable[name]; ok {
+			diagnostic = newDiagnostic(command.Pos, "constant %q conflicts with predefined symbol", name)
+		}
+		if diagnostic != nil {
+			if err := p.report(diagnostic); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var value uint16
+		if isDecimal(command.Value) {
+			n, err := strconv.ParseUint(command.Value, 10, 64)
+			if err != nil || n > max {
+				diagnostic = newDiagnostic(command.Pos, "value %s of constant %q is greater than %d", command.Value, name, max)
+			}
+			value = uint16(n)
+		} else {
+			value, diagnostic = p.evalConstant(command, max)
+		}
+		if diagnostic != nil {
+			if err := p.report(diagnostic); err != nil {
+				return err
+			}
+			continue
+		}
+
+		p.symbolTable[name] = value
+		p.constants[name] = command.Pos
+		p.Commands[i].SymbolInt = value
+	}
 	return nil
 }
 
-func (p *Parser) parseACommandSymbolToInt() {
+// evalConstant evaluates the expression value of constant. Symbols in the value should be defined before.
+func (p *Parser) evalConstant(command Command, max uint64) (uint16, *Diagnostic) {
+	expr, err := parseExpressionText(command.Value, command.Pos)
+	if err != nil {
+		return 0, err.(*Diagnostic)
+	}
+	value, err := expr.eval(func(name string) (int64, error) {
+		value, ok := p.symbolTable[name]
+		if !ok {
+			return 0, newDiagnostic(command.Pos, "undefined symbol %q in value of constant %q", name, command.Symbol)
+		}
+		return int64(value), nil
+	})
+	if err != nil {
+		return 0, err.(*Diagnostic)
+	}
+	if value < 0 || value > int64(max) {
+		return 0, newDiagnostic(command.Pos, "value %s = %d of constant %q is not between 0 and %d", command.Value, value, command.Symbol, max)
+	}
+	return uint16(value), nil
+}
+
+func (p *Parser) parseACommandSymbolToInt() error {
+	// A command value is 15 bits
+	_, max, err := bitsMinMax(15, true)
+	if err != nil {
+		return err
+	}
+
 	for i, command := range p.Commands {
 		if command.CommandType == ACommand {
 			symbol := command.Symbol
 			symbolInt, err := strconv.ParseUint(symbol, 10, 64)
 			// symbol is int string
 			if err == nil {
+				if symbolInt > max {
+					err := p.report(newDiagnostic(command.Pos, "A command value %s is greater than %d", symbol, max))
+					if err != nil {
+						return err
+					}
+					continue
+				}
 				p.Commands[i].SymbolInt = uint16(symbolInt)
 				continue
 			}
 
 			// symbol is not int string but variable
-			if symbolInt16, ok := p.symbolTable[symbol]; ok {
-				p.Commands[i].SymbolInt = symbolInt16
-			} else {
-				p.symbolTable[symbol] = p.currentRAMAddr
-				p.Commands[i].SymbolInt = p.currentRAMAddr
-				p.currentRAMAddr += 1
+			if isSymbol(symbol) {
+				p.Commands[i].SymbolInt = p.variable(symbol, command.Pos)
+				continue
+			}
+
+			// symbol is an expression like SCREEN+32*row
+			expr, err := parseExpressionText(symbol, command.Pos)
+			var value int64
+			if err == nil {
+				value, err = expr.eval(func(name string) (int64, error) {
+					return int64(p.variable(name, command.Pos)), nil
+				})
+			}
+			if err == nil && (value < 0 || value > int64(max)) {
+				err = newDiagnostic(command.Pos, "A command value %s = %d is not between 0 and %d", symbol, value, max)
 			}
+			if err != nil {
+				if err := p.report(err.(*Diagnostic)); err != nil {
+					return err
+				}
+				continue
+			}
+			p.Commands[i].SymbolInt = uint16(value)
 		}
 	}
+	return nil
 }
 
-// Advance reads next line and make it to current command
-func (p *Parser) Advance() bool {
-	// TODO: comment should be considered
-	// TODO: only whitespace line should be considered
+// variable returns the value of symbol. A new variable is allocated in RAM for an unknown symbol.
+func (p *Parser) variable(symbol string, pos Position) uint16 {
+	if value, ok := p.symbolTable[symbol]; ok {
+		return value
+	}
+	if label, ok := p.labelFold(symbol); ok {
+		// warnings never stop parsing
+		p.report(newWarning(pos, "variable %q differs from label %q only by case, declared at %s", symbol, label, p.labels[label]))
+	}
+	p.symbolTable[symbol] = p.currentRAMAddr
+	p.currentRAMAddr += 1
+	return p.symbolTable[symbol]
+}
 
+// labelFold returns the label which is equal to symbol under case folding.
+func (p *Parser) labelFold(symbol string) (string, bool) {
+	for label := range p.labels {
+		if strings.EqualFold(label, symbol) {
+			return label, true
+		}
+	}
+	return "", false
+}
+
+// LookupSymbol returns the address of a predefined symbol, a label or a variable,
+// or the value of a constant after Parse.
+func (p *Parser) LookupSymbol(name string) (uint16, bool) {
+	addr, ok := p.symbolTable[name]
+	return addr, ok
+}
+
+// IsLabel reports whether name is a label declared in the program, after Parse.
+func (p *Parser) IsLabel(name string) bool {
+	_, ok := p.labels[name]
+	return ok
+}
+
+// IsConstant reports whether name is a constant defined in the program, after Parse.
+func (p *Parser) IsConstant(name string) bool {
+	_, ok := p.constants[name]
+	return ok
+}
+
+// Advance reads next line which has a command and make it to current command.
+// Blank lines and comment only lines are skipped, and comments after commands are removed.
+// Macro definitions are read, and macro invocations are replaced by the lines of their expansions.
+// Lines of files included by .include are read in place of the directive.
+// It returns false when there is no more command or reading fails. Err reports the failure.
+func (p *Parser) Advance() bool {
 	// reset
-	p.currentCommand = ""
+	p.currentTokens = nil
+	p.currentText = ""
+	p.currentErr = nil
+
+	for {
+		line, ok := p.nextLine()
+		if !ok {
+			if m := p.defining; m != nil && p.err == nil {
+				p.defining = nil
+				p.currentPos = m.pos
+				p.currentErr = newDiagnostic(m.pos, "missing %s of macro %q", endmDirective, m.name)
+				return true
+			}
+			return false
+		}
+
+		var err *Diagnostic
+		first := line.tokens[0]
+		switch {
+		case p.defining != nil && line.isDirective(endmDirective):
+			err = p.endMacro(line)
+		case p.defining != nil && line.isDirective(macroDirective):
+			err = newDiagnostic(line.pos, "%s in macro %q", macroDirective, p.defining.name)
+		case p.defining != nil && line.isDirective(includeDirective):
+			err = newDiagnostic(line.pos, "%s in macro %q", includeDirective, p.defining.name)
+		case p.defining != nil:
+			p.defining.body = append(p.defining.body, line)
+		case line.isDirective(macroDirective):
+			err = p.beginMacro(line)
+		case line.isDirective(endmDirective):
+			err = newDiagnostic(line.pos, "%s without %s", endmDirective, macroDirective)
+		case line.isDirective(includeDirective):
+			err = p.include(line)
+		case first.Type == IdentToken && p.macros[first.Text] != nil:
+			err = p.expandMacro(p.macros[first.Text], line)
+		default:
+			p.currentTokens = line.tokens
+			p.currentPos = line.pos
+			p.currentText = line.text
+			return true
+		}
+		if err != nil {
+			p.currentTokens = line.tokens
+			p.currentPos = line.pos
+			p.currentText = line.text
+			p.currentErr = err
+			return true
+		}
+	}
+}
 
-	if p.scanner.Scan() {
-		p.currentCommand = strings.ReplaceAll(strings.TrimSpace(p.scanner.Text()), " ", "")
-		return true
+// nextLine returns the next line of macro expansions or the source which has tokens.
+func (p *Parser) nextLine() (sourceLine, bool) {
+	if len(p.expanded) > 0 {
+		line := p.expanded[0]
+		p.expanded = p.expanded[1:]
+		return line, true
 	}
 
-	if err := p.scanner.Err(); err != nil {
-		panic(fmt.Sprintf("error when reading command file: %s", err))
+	// lexer is created here because Filename can be set after NewParser
+	if p.lexer == nil {
+		p.lexer = NewLexer(p.reader, p.Filename)
 	}
 
-	return false
+	var tokens []Token
+	for {
+		token := p.lexer.Next()
+		switch token.Type {
+		case EOFToken:
+			if err := p.lexer.Err(); err != nil {
+				p.err = newDiagnostic(token.Pos, "error when reading command file: %s", err)
+				return sourceLine{}, false
+			}
+			if len(p.includes) > 0 {
+				// the rest of the including file
+				p.lexer = p.includes[len(p.includes)-1]
+				p.includes = p.includes[:len(p.includes)-1]
+				continue
+			}
+			return sourceLine{}, false
+		case CommentToken:
+			if origin, ok := parseOriginComment(token.Text); ok {
+				p.currentOrigin = origin
+			}
+			continue
+		case NewlineToken:
+			if len(tokens) == 0 {
+				continue
+			}
+			first, last := tokens[0], tokens[len(tokens)-1]
+			text := p.lexer.Line()[first.Pos.Column-1 : last.Pos.Column-1+len(last.Text)]
+			return sourceLine{tokens: tokens, text: text, pos: first.Pos}, true
+		default:
+			tokens = append(tokens, token)
+		}
+	}
+}
+
+// Err returns the error which stopped Advance, or nil when all lines are read.
+func (p *Parser) Err() error {
+	return p.err
 }
 
-// ParseOne parses currentCommand and convert it to Command object
-func (p *Parser) ParseOne() Command {
-	var symbol, dest, comp, jump string
+// ParseOne parses current command tokens and convert it to Command object.
+// It returns *Diagnostic as error when the command has syntax error.
+func (p *Parser) ParseOne() (Command, error) {
+	if p.currentErr != nil {
+		return Command{}, p.currentErr
+	}
+
+	// empty line has no command
+	if len(p.currentTokens) == 0 {
+		return Command{}, nil
+	}
+
+	for _, token := range p.currentTokens {
+		if token.Type == IllegalToken {
+			return Command{}, newDiagnostic(token.Pos, "unexpected character %s", token)
+		}
+	}
+
+	var symbol, value, dest, comp, jump string
+	var err error
 	commandType := p.commandType()
 
 	if commandType == ACommand {
-		symbol = p.symbolFromACommand()
+		symbol, err = p.symbolFromACommand()
 	} else if commandType == LCommand {
-		symbol = p.symbolFromLCommand()
+		symbol, err = p.symbolFromLCommand()
+	} else if commandType == EquCommand {
+		symbol, value, err = p.constantFromEquCommand()
 	} else if commandType == CCommand {
-		dest, comp, jump = p.destCompJump()
+		dest, comp, jump, err = p.destCompJump()
+	}
+	if err != nil {
+		return Command{}, err
 	}
 
 	return Command{
@@ -166,46 +598,318 @@ func (p *Parser) ParseOne() Command {
 		Dest: dest,
 		Comp: comp,
 		Jump: jump,
+		Value: value,
+		Pos: p.currentPos,
+		Text: p.currentText,
+		Origin: p.currentOrigin,
+	}, nil
+}
+
+// originCommentPrefix starts a comment which gives the origin of the following commands,
+// e.g. "//# source Foo.vm:12" by a VM translator. "//# source" without position clears the origin.
+const originCommentPrefix = "//# source"
+
+// parseOriginComment returns the position of origin comment "//# source file:line[:column]".
+// It returns false when comment is not an origin comment.
+func parseOriginComment(comment string) (Position, bool) {
+	if !strings.HasPrefix(comment, originCommentPrefix) {
+		return Position{}, false
+	}
+	rest := comment[len(originCommentPrefix):]
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		// other words like "//# sourcemap"
+		return Position{}, false
+	}
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return Position{}, true
 	}
+
+	pos := Position{File: rest}
+	numbers := []*int{&pos.Column, &pos.Line}
+	for i := 0; i < 2; i++ {
+		colon := strings.LastIndexByte(pos.File, ':')
+		if colon < 0 {
+			break
+		}
+		n, err := strconv.Atoi(pos.File[colon+1:])
+		if err != nil || n < 1 {
+			break
+		}
+		*numbers[i] = n
+		pos.File = pos.File[:colon]
+	}
+	if pos.Line == 0 {
+		// only line is given
+		pos.Line, pos.Column = pos.Column, 0
+	}
+	if pos.File == "" || pos.Line == 0 {
+		return Position{}, false
+	}
+	return pos, true
 }
 
 func (p *Parser) commandType() CommandType {
-	if p.currentCommand[0] == '@' {
+	// empty line has no command
+	if len(p.currentTokens) == 0 {
+		return ""
+	}
+
+	if p.currentTokens[0].Type == AtToken {
 		return ACommand
 	}
 
-	if p.currentCommand[0] == '(' {
+	if p.currentTokens[0].Type == LParenToken {
 		return LCommand
 	}
 
+	if first := p.currentTokens[0]; first.Type == IdentToken && (first.Text == equDirective || first.Text == defineDirective) {
+		return EquCommand
+	}
+
 	return CCommand
 }
 
-func (p *Parser) symbolFromACommand() string {
-	return strings.TrimLeft(p.currentCommand, "@")
+// symbolFromACommand returns the symbol of "@symbol".
+// symbol is a decimal number, a hack symbol or an expression of them, e.g. "SCREEN+32*row".
+func (p *Parser) symbolFromACommand() (string, error) {
+	tokens := p.currentTokens[1:]
+	if len(tokens) == 0 {
+		return "", newDiagnostic(p.endPos(), "missing symbol after @")
+	}
+	expr, n, err := parseExpression(tokens, p.endPos())
+	if err != nil {
+		return "", err
+	}
+	if n < len(tokens) {
+		if expr.op.Type == "" {
+			return "", newDiagnostic(tokens[n].Pos, "unexpected %s after symbol %q", tokens[n], tokens[0].Text)
+		}
+		return "", newDiagnostic(tokens[n].Pos, "unexpected %s after expression %q", tokens[n], joinTokens(tokens[:n]))
+	}
+	return joinTokens(tokens), nil
+}
+
+// symbolFromLCommand returns the label of "(label)".
+func (p *Parser) symbolFromLCommand() (string, error) {
+	tokens := p.currentTokens[1:]
+	if len(tokens) == 0 || tokens[0].Type == RParenToken {
+		return "", newDiagnostic(p.currentPos, "missing label name in %q", p.currentText)
+	}
+	if err := validateSymbol(tokens[0], false); err != nil {
+		return "", err
+	}
+	if len(tokens) == 1 {
+		return "", newDiagnostic(p.endPos(), "missing ) after label %q", tokens[0].Text)
+	}
+	if tokens[1].Type != RParenToken {
+		return "", newDiagnostic(tokens[1].Pos, "unexpected %s in label, expected )", tokens[1])
+	}
+	if len(tokens) > 2 {
+		return "", newDiagnostic(tokens[2].Pos, "unexpected %s after label", tokens[2])
+	}
+	return tokens[0].Text, nil
+}
+
+// equDirective and defineDirective define constants, e.g. ".equ SCREEN_WORDS 8192"
+const (
+	equDirective    = ".equ"
+	defineDirective = ".define"
+)
+
+// constantFromEquCommand returns the name and the value of ".equ name value".
+// value is a decimal number, a hack symbol or an expression of them.
+func (p *Parser) constantFromEquCommand() (string, string, error) {
+	directive := p.currentTokens[0].Text
+	tokens := p.currentTokens[1:]
+	if len(tokens) == 0 {
+		return "", "", newDiagnostic(p.endPos(), "missing constant name after %s", directive)
+	}
+	if tokens[0].Type == NumberToken {
+		return "", "", newDiagnostic(tokens[0].Pos, "constant %q must not start with a digit", tokens[0].Text)
+	}
+	if tokens[0].Type != IdentToken {
+		return "", "", newDiagnostic(tokens[0].Pos, "unexpected %s, expected constant name", tokens[0])
+	}
+	name := tokens[0].Text
+	if len(tokens) == 1 {
+		return "", "", newDiagnostic(p.endPos(), "missing value of constant %q", name)
+	}
+	tokens = tokens[1:]
+	_, n, err := parseExpression(tokens, p.endPos())
+	if err != nil {
+		return "", "", err
+	}
+	if n < len(tokens) {
+		return "", "", newDiagnostic(tokens[n].Pos, "unexpected %s after value of constant %q", tokens[n], name)
+	}
+	return name, joinTokens(tokens), nil
+}
+
+// validateSymbol checks the token is a hack symbol which consists of letters, digits,
+// '_', '.', '$' and ':', and does not start with a digit.
+// Number and character literals are also accepted when allowNumber is true.
+func validateSymbol(token Token, allowNumber bool) error {
+	switch token.Type {
+	case IdentToken:
+		return nil
+	case NumberToken:
+		if allowNumber && isNumber(token.Text) {
+			return nil
+		}
+		if !allowNumber {
+			return newDiagnostic(token.Pos, "label %q must not start with a digit", token.Text)
+		}
+		if base, _ := numberBase(token.Text); base != 10 {
+			return newDiagnostic(token.Pos, "invalid number %q", token.Text)
+		}
+		return newDiagnostic(token.Pos, "symbol %q must not start with a digit", token.Text)
+	case CharToken:
+		if allowNumber {
+			return nil
+		}
+	}
+	return newDiagnostic(token.Pos, "unexpected %s, expected symbol", token)
+}
+
+// isSymbol reports whether s is a hack symbol, not a number or an expression.
+func isSymbol(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isSymbolChar(s[i]) {
+			return false
+		}
+	}
+	return s != "" && !isDigit(s[0])
+}
+
+// numberBase returns the base of number literal s and s without prefix of the base,
+// e.g. 16 and "4000" for "0x4000".
+func numberBase(s string) (int, string) {
+	if len(s) > 2 && s[0] == '0' {
+		switch s[1] {
+		case 'x', 'X':
+			return 16, s[2:]
+		case 'b', 'B':
+			return 2, s[2:]
+		}
+	}
+	return 10, s
 }
 
-func (p *Parser) symbolFromLCommand() string {
-	return strings.TrimRight(strings.TrimLeft(p.currentCommand, "("), ")")
+// isNumber reports whether s is a decimal, hexadecimal "0x4000" or binary "0b1010" number.
+func isNumber(s string) bool {
+	base, digits := numberBase(s)
+	if base == 10 {
+		return isDecimal(s)
+	}
+	for i := 0; i < len(digits); i++ {
+		c := digits[i] | 0x20 // lower case of letters
+		if !(isDigit(digits[i]) && int(digits[i]-'0') < base || base == 16 && 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseNumber returns the value of number literal s or character literal like 'A'.
+// It returns false when s is not a literal or the value is too large.
+func parseNumber(s string) (int64, bool) {
+	if c, ok := charLiteral(s); ok {
+		return int64(c), true
+	}
+	if !isNumber(s) {
+		return 0, false
+	}
+	base, digits := numberBase(s)
+	n, err := strconv.ParseInt(digits, base, 64)
+	return n, err == nil
 }
 
-func (p *Parser) destCompJump() (dest string, comp string, jump string) {
+// isDecimal reports whether s consists of decimal digits only.
+func isDecimal(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func (p *Parser) destCompJump() (dest string, comp string, jump string, err error) {
 	// C type command: dest=comp;jump
 	// jump or dest can be omitted
-	jumpSplit := strings.Split(p.currentCommand, ";")
-	if len(jumpSplit) == 2 {
+	tokens := p.currentTokens
+
+	semicolon := indexToken(tokens, SemicolonToken)
+	if semicolon >= 0 {
 		// e.g. D;JGT
-		jump = jumpSplit[1]
+		if i := indexToken(tokens[semicolon+1:], SemicolonToken); i >= 0 {
+			return "", "", "", newDiagnostic(tokens[semicolon+1+i].Pos, "multiple \";\" in %q", p.currentText)
+		}
+		jumpTokens := tokens[semicolon+1:]
+		if len(jumpTokens) == 0 {
+			return "", "", "", newDiagnostic(p.endPos(), "missing jump after \";\"")
+		}
+		if len(jumpTokens) > 1 || jumpTokens[0].Type != IdentToken {
+			return "", "", "", newDiagnostic(jumpTokens[0].Pos, "invalid jump %q", joinTokens(jumpTokens))
+		}
+		jump = jumpTokens[0].Text
+		tokens = tokens[:semicolon]
 	}
-	destComp := jumpSplit[0]
-	destCompSplit := strings.Split(destComp, "=")
-	if len(destCompSplit) == 2 {
+
+	if i := indexToken(tokens, AssignToken); i >= 0 {
 		// e.g. D=D+A
-		dest = destCompSplit[0]
-		comp = destCompSplit[1]
-	} else {
-		// e.g. D;JGT
-		comp = destCompSplit[0]
+		if j := indexToken(tokens[i+1:], AssignToken); j >= 0 {
+			return "", "", "", newDiagnostic(tokens[i+1+j].Pos, "multiple \"=\" in %q", p.currentText)
+		}
+		destTokens := tokens[:i]
+		if len(destTokens) == 0 {
+			return "", "", "", newDiagnostic(tokens[i].Pos, "missing dest before \"=\"")
+		}
+		if len(destTokens) > 1 || destTokens[0].Type != IdentToken {
+			return "", "", "", newDiagnostic(destTokens[0].Pos, "invalid dest %q", joinTokens(destTokens))
+		}
+		dest = destTokens[0].Text
+		tokens = tokens[i+1:]
 	}
+
+	if len(tokens) == 0 {
+		return "", "", "", newDiagnostic(p.currentPos, "missing comp in %q", p.currentText)
+	}
+	for _, token := range tokens {
+		switch token.Type {
+		case IdentToken, NumberToken, PlusToken, MinusToken, NotToken, AndToken, OrToken:
+		default:
+			return "", "", "", newDiagnostic(token.Pos, "unexpected %s in comp", token)
+		}
+	}
+	comp = joinTokens(tokens)
 	return
 }
+
+// endPos returns the position just after the last token of current command.
+func (p *Parser) endPos() Position {
+	last := p.currentTokens[len(p.currentTokens)-1]
+	pos := last.Pos
+	pos.Column += len(last.Text)
+	return pos
+}
+
+// indexToken returns the index of the first token with tokenType, or -1.
+func indexToken(tokens []Token, tokenType TokenType) int {
+	for i, token := range tokens {
+		if token.Type == tokenType {
+			return i
+		}
+	}
+	return -1
+}
+
+// joinTokens returns concatenated texts of tokens. e.g. D + A -> "D+A"
+func joinTokens(tokens []Token) string {
+	var builder strings.Builder
+	for _, token := range tokens {
+		builder.WriteString(token.Text)
+	}
+	return builder.String()
+}
@@ -1,11 +1,35 @@
 package assembler
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 )
 
+// errReader returns err after all data is read.
+type errReader struct {
+	data string
+	err  error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// newLineParser returns *Parser which has line as current command.
+func newLineParser(line string) *Parser {
+	parser := NewParser(strings.NewReader(line))
+	parser.Advance()
+	return parser
+}
+
 func TestParser_Parse(t *testing.T) {
 	reader := strings.NewReader(
 		`@i
@@ -23,14 +47,14 @@ D=D+A;JGT
 	}
 
 	wantedCommands := []Command{
-		{CommandType: ACommand, Symbol: "i", SymbolInt: 16},
-		{CommandType: ACommand, Symbol: "100", SymbolInt: 100},
-		{CommandType: LCommand, Symbol: "LOOP"},
-		{CommandType: ACommand, Symbol: "LOOP1", SymbolInt: 6},
-		{CommandType: CCommand, Dest: "", Comp: "D", Jump: "JGT"},
-		{CommandType: CCommand, Dest: "D", Comp: "D+A", Jump: ""},
-		{CommandType: CCommand, Dest: "D", Comp: "D+A", Jump: "JGT"},
-		{CommandType: LCommand, Symbol: "LOOP1"},
+		{CommandType: ACommand, Symbol: "i", SymbolInt: 16, Pos: Position{Line: 1, Column: 1}, Text: "@i"},
+		{CommandType: ACommand, Symbol: "100", SymbolInt: 100, Pos: Position{Line: 2, Column: 1}, Text: "@100"},
+		{CommandType: LCommand, Symbol: "LOOP", Pos: Position{Line: 3, Column: 1}, Text: "(LOOP)"},
+		{CommandType: ACommand, Symbol: "LOOP1", SymbolInt: 6, Pos: Position{Line: 4, Column: 1}, Text: "@LOOP1"},
+		{CommandType: CCommand, Dest: "", Comp: "D", Jump: "JGT", Pos: Position{Line: 5, Column: 1}, Text: "D;JGT"},
+		{CommandType: CCommand, Dest: "D", Comp: "D+A", Jump: "", Pos: Position{Line: 6, Column: 1}, Text: "D=D+A"},
+		{CommandType: CCommand, Dest: "D", Comp: "D+A", Jump: "JGT", Pos: Position{Line: 7, Column: 1}, Text: "D=D+A;JGT"},
+		{CommandType: LCommand, Symbol: "LOOP1", Pos: Position{Line: 8, Column: 1}, Text: "(LOOP1)"},
 	}
 
 	if len(parser.Commands) != len(wantedCommands) {
@@ -45,6 +69,35 @@ D=D+A;JGT
 	}
 }
 
+func TestParser_Parse_recover(t *testing.T) {
+	reader := strings.NewReader(
+		`@40000
+(R0)
+(R1)
+@1`)
+	parser := NewParser(reader)
+	parser.Recover = true
+	err := parser.Parse()
+
+	diagnostics, ok := err.(Diagnostics)
+	if !ok {
+		t.Fatalf("parser.Parse() error type = %T, want Diagnostics", err)
+	}
+
+	wantedLines := []int{1, 2, 3}
+	if len(diagnostics) != len(wantedLines) {
+		t.Fatalf("len(diagnostics) = %d, but want %d", len(diagnostics), len(wantedLines))
+	}
+	for i, diagnostic := range diagnostics {
+		if diagnostic.Pos.Line != wantedLines[i] {
+			t.Errorf("diagnostics[%d].Pos.Line = %d, but want %d", i, diagnostic.Pos.Line, wantedLines[i])
+		}
+	}
+	if parser.Commands[3].SymbolInt != 1 {
+		t.Errorf("parser.Commands[3].SymbolInt = %d, but want 1", parser.Commands[3].SymbolInt)
+	}
+}
+
 func TestParser_parseToCommands(t *testing.T) {
 	reader := strings.NewReader(
 		`@i
@@ -55,12 +108,12 @@ D=D+A
 D=D+A;JGT`)
 
 	wantedCommands := []Command{
-		{CommandType: ACommand, Symbol: "i"},
-		{CommandType: ACommand, Symbol: "100"},
-		{CommandType: LCommand, Symbol: "LOOP"},
-		{CommandType: CCommand, Dest: "", Comp: "D", Jump: "JGT"},
-		{CommandType: CCommand, Dest: "D", Comp: "D+A", Jump: ""},
-		{CommandType: CCommand, Dest: "D", Comp: "D+A", Jump: "JGT"},
+		{CommandType: ACommand, Symbol: "i", Pos: Position{Line: 1, Column: 1}, Text: "@i"},
+		{CommandType: ACommand, Symbol: "100", Pos: Position{Line: 2, Column: 1}, Text: "@100"},
+		{CommandType: LCommand, Symbol: "LOOP", Pos: Position{Line: 3, Column: 1}, Text: "(LOOP)"},
+		{CommandType: CCommand, Dest: "", Comp: "D", Jump: "JGT", Pos: Position{Line: 4, Column: 1}, Text: "D;JGT"},
+		{CommandType: CCommand, Dest: "D", Comp: "D+A", Jump: "", Pos: Position{Line: 5, Column: 1}, Text: "D=D+A"},
+		{CommandType: CCommand, Dest: "D", Comp: "D+A", Jump: "JGT", Pos: Position{Line: 6, Column: 1}, Text: "D=D+A;JGT"},
 	}
 
 	parser := NewParser(reader)
@@ -78,6 +131,34 @@ D=D+A;JGT`)
 	}
 }
 
+func TestParser_parseToCommands_position(t *testing.T) {
+	reader := strings.NewReader("@i\n  D = D + A\n\t(LOOP)")
+
+	wantedCommands := []Command{
+		{CommandType: ACommand, Symbol: "i",
+			Pos: Position{File: "Foo.asm", Line: 1, Column: 1}, Text: "@i"},
+		{CommandType: CCommand, Dest: "D", Comp: "D+A",
+			Pos: Position{File: "Foo.asm", Line: 2, Column: 3}, Text: "D = D + A"},
+		{CommandType: LCommand, Symbol: "LOOP",
+			Pos: Position{File: "Foo.asm", Line: 3, Column: 2}, Text: "(LOOP)"},
+	}
+
+	parser := NewParser(reader)
+	parser.Filename = "Foo.asm"
+	parser.parseToCommands()
+
+	if len(parser.Commands) != len(wantedCommands) {
+		t.Errorf("len(parser.Commands) = %d, but want %d", len(parser.Commands), len(wantedCommands))
+	}
+
+	for i, got := range parser.Commands {
+		wanted := wantedCommands[i]
+		if got != wanted {
+			t.Errorf("parser.Commands[%d] = +%v, but want +%v", i, got, wanted)
+		}
+	}
+}
+
 func TestParser_fillSymbolTable_success(t *testing.T) {
 	reader := strings.NewReader(
 		`@i
@@ -107,6 +188,225 @@ D=D+A;JGT
 	}
 }
 
+func TestParser_LookupSymbol(t *testing.T) {
+	parser := NewParser(strings.NewReader("@i\n(LOOP)\n@LOOP\n0;JMP\n"))
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("parser.Parse() results in error: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		addr    uint16
+		ok      bool
+		isLabel bool
+	}{
+		{name: "i", addr: 16, ok: true},
+		{name: "LOOP", addr: 1, ok: true, isLabel: true},
+		{name: "KBD", addr: 24576, ok: true},
+		{name: "j", ok: false},
+	}
+	for _, test := range tests {
+		addr, ok := parser.LookupSymbol(test.name)
+		if addr != test.addr || ok != test.ok {
+			t.Errorf("parser.LookupSymbol(%s) = %d, %t, want %d, %t", test.name, addr, ok, test.addr, test.ok)
+		}
+		if got := parser.IsLabel(test.name); got != test.isLabel {
+			t.Errorf("parser.IsLabel(%s) = %t, want %t", test.name, got, test.isLabel)
+		}
+	}
+}
+
+func TestParser_Parse_constant(t *testing.T) {
+	parser := NewParser(strings.NewReader(`.equ SCREEN_WORDS 8192
+.equ LAST SCREEN_WORDS
+.define START LOOP
+.equ BASE SCREEN
+(LOOP)
+@SCREEN_WORDS
+@LAST
+@START
+@BASE
+@i
+`))
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("parser.Parse() results in error: %s", err)
+	}
+
+	var got []uint16
+	for _, command := range parser.Commands {
+		if command.CommandType == ACommand {
+			got = append(got, command.SymbolInt)
+		}
+	}
+	// constants do not allocate RAM, so i is at 16
+	wanted := []uint16{8192, 8192, 0, 16384, 16}
+	if !reflect.DeepEqual(got, wanted) {
+		t.Errorf("SymbolInt of A commands = %v, want %v", got, wanted)
+	}
+	if !parser.IsConstant("LAST") || parser.IsConstant("LOOP") || parser.IsConstant("i") {
+		t.Errorf("parser.IsConstant() should be true only for constants")
+	}
+	if value, ok := parser.LookupSymbol("START"); !ok || value != 0 {
+		t.Errorf("parser.LookupSymbol(START) = %d, %t, want 0, true", value, ok)
+	}
+}
+
+func TestParser_Parse_expression(t *testing.T) {
+	parser := NewParser(strings.NewReader(`.equ ROW 2
+.equ SCREEN_WORDS 8192
+.equ LAST SCREEN+SCREEN_WORDS-1
+(LOOP)
+@SCREEN+32*ROW
+@LOOP+2
+@(KBD-1)
+@arr+5
+@arr
+@1+2*3
+@(1+2)*3
+@7/2
+@7%2
+@1<<14
+@KBD>>1
+@6&3|8
+@-1+1
+@i-arr
+@LAST
+`))
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("parser.Parse() results in error: %s", err)
+	}
+
+	var got []uint16
+	for _, command := range parser.Commands {
+		if command.CommandType == ACommand {
+			got = append(got, command.SymbolInt)
+		}
+	}
+	// arr is allocated at 16 and i at 17
+	wanted := []uint16{16448, 2, 24575, 21, 16, 7, 9, 3, 1, 16384, 12288, 10, 0, 1, 24575}
+	if !reflect.DeepEqual(got, wanted) {
+		t.Errorf("SymbolInt of A commands = %v, want %v", got, wanted)
+	}
+}
+
+func TestParser_Parse_expressionError(t *testing.T) {
+	tests := []struct {
+		source string
+		wanted string
+	}{
+		{source: "@KBD+KBD\n", wanted: `Foo.asm:1:1: A command value KBD+KBD = 49152 is not between 0 and 32767`},
+		{source: "@0-1\n", wanted: `Foo.asm:1:1: A command value 0-1 = -1 is not between 0 and 32767`},
+		{source: "@1/(1-1)\n", wanted: `Foo.asm:1:1: division by zero`},
+		{source: "@1%0\n", wanted: `Foo.asm:1:1: division by zero`},
+		{source: "@1<<64\n", wanted: `Foo.asm:1:1: invalid shift count 64`},
+		{source: "@1+99999999999999999999\n", wanted: `Foo.asm:1:1: number 99999999999999999999 is too large`},
+		{source: "@0x7fffffffffffffff*2+2\n", wanted: `Foo.asm:1:1: number 0x7fffffffffffffff is too large`},
+		{source: "@65536*65536*4\n", wanted: `Foo.asm:1:1: overflow in 65536 * 65536`},
+		{source: "@(1<<40)-(1<<40)\n", wanted: `Foo.asm:1:1: overflow in 1 << 40`},
+		{source: "@1<<62<<2\n", wanted: `Foo.asm:1:1: overflow in 1 << 62`},
+		{source: "@(0-32768)*65536*65536\n", wanted: `Foo.asm:1:1: overflow in -2147483648 * 65536`},
+		{source: ".equ N KBD*2\n", wanted: `Foo.asm:1:1: value KBD*2 = 49152 of constant "N" is not between 0 and 32767`},
+	}
+	for _, test := range tests {
+		parser := NewParser(strings.NewReader(test.source))
+		parser.Filename = "Foo.asm"
+		err := parser.Parse()
+		if err == nil {
+			t.Errorf("parser.Parse() should return error for %q", test.source)
+			continue
+		}
+		if err.Error() != test.wanted {
+			t.Errorf("parser.Parse() error = %s, want %s", err, test.wanted)
+		}
+	}
+}
+
+func TestParser_Parse_literal(t *testing.T) {
+	parser := NewParser(strings.NewReader(`@0x4000
+@0X7fff
+@0b1010
+@'A'
+@'\''
+@SCREEN+'a'
+@-1
+@-0
+@-0x8000
+@-'A'
+(END)
+@END
+`))
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("parser.Parse() results in error: %s", err)
+	}
+
+	var got []string
+	for _, command := range parser.Commands {
+		if command.CommandType == ACommand {
+			got = append(got, fmt.Sprint(command.SymbolInt))
+		} else {
+			got = append(got, command.String())
+		}
+	}
+	// @-N is @N-1 and A=!A, so END is at 13
+	wanted := []string{"16384", "32767", "10", "65", "39", "16481",
+		"0", "A=!A", "0", "32767", "A=!A", "64", "A=!A", "(END)", "13"}
+	if !reflect.DeepEqual(got, wanted) {
+		t.Errorf("parser.Commands = %v, want %v", got, wanted)
+	}
+	if parser.Commands[7].Text != "@-1" || parser.Commands[7].Pos.Line != 7 {
+		t.Errorf("A=!A of @-1 should have the text and position of @-1: %+v", parser.Commands[7])
+	}
+}
+
+func TestParser_Parse_literalError(t *testing.T) {
+	tests := []struct {
+		source string
+		wanted string
+	}{
+		{source: "@0x8000\n", wanted: `Foo.asm:1:1: A command value 0x8000 = 32768 is not between 0 and 32767`},
+		{source: "@-32769\n", wanted: `Foo.asm:1:1: A command value -32769 is not between -32768 and 32767`},
+		{source: "@-0x10000000000000000\n", wanted: `Foo.asm:1:1: A command value -0x10000000000000000 is not between -32768 and 32767`},
+		{source: "@-1+0\n", wanted: `Foo.asm:1:1: A command value -1+0 = -1 is not between 0 and 32767`},
+	}
+	for _, test := range tests {
+		parser := NewParser(strings.NewReader(test.source))
+		parser.Filename = "Foo.asm"
+		err := parser.Parse()
+		if err == nil {
+			t.Errorf("parser.Parse() should return error for %q", test.source)
+			continue
+		}
+		if err.Error() != test.wanted {
+			t.Errorf("parser.Parse() error = %s, want %s", err, test.wanted)
+		}
+	}
+}
+
+func TestParser_Parse_constantError(t *testing.T) {
+	tests := []struct {
+		source string
+		wanted string
+	}{
+		{source: ".equ N 1\n.equ N 2\n", wanted: `Foo.asm:2:1: constant "N" already defined at Foo.asm:1:1`},
+		{source: "(N)\n.equ N 2\n", wanted: `Foo.asm:2:1: constant "N" conflicts with label declared at Foo.asm:1:1`},
+		{source: ".equ KBD 2\n", wanted: `Foo.asm:1:1: constant "KBD" conflicts with predefined symbol`},
+		{source: ".equ N 32768\n", wanted: `Foo.asm:1:1: value 32768 of constant "N" is greater than 32767`},
+		{source: ".equ N M\n.equ M 1\n", wanted: `Foo.asm:1:1: undefined symbol "M" in value of constant "N"`},
+	}
+	for _, test := range tests {
+		parser := NewParser(strings.NewReader(test.source))
+		parser.Filename = "Foo.asm"
+		err := parser.Parse()
+		if err == nil {
+			t.Errorf("parser.Parse() should return error for %q", test.source)
+			continue
+		}
+		if err.Error() != test.wanted {
+			t.Errorf("parser.Parse() error = %s, want %s", err, test.wanted)
+		}
+	}
+}
+
 func TestParser_fillSymbolTable_error(t *testing.T) {
 	reader := strings.NewReader(
 		`@i
@@ -127,6 +427,57 @@ D=D+A;JGT
 	fmt.Println(fmt.Sprintf("Error Message Check: %s", err))
 }
 
+func TestParser_fillSymbolTable_duplicate(t *testing.T) {
+	reader := strings.NewReader(
+		`(LOOP)
+@LOOP
+0;JMP
+  (LOOP)`)
+
+	parser := NewParser(reader)
+	parser.Filename = "Foo.asm"
+	parser.parseToCommands()
+	err := parser.fillSymbolTable()
+	if err == nil {
+		t.Fatalf("parser.fillSymbolTable() should not be nil")
+	}
+
+	wanted := `Foo.asm:4:3: label "LOOP" already declared at Foo.asm:1:1`
+	if err.Error() != wanted {
+		t.Errorf("parser.fillSymbolTable() error = %s, want %s", err, wanted)
+	}
+	if parser.symbolTable["LOOP"] != 0 {
+		t.Errorf("LOOP label ROM addr %d, but want 0", parser.symbolTable["LOOP"])
+	}
+}
+
+func TestParser_Parse_caseWarning(t *testing.T) {
+	reader := strings.NewReader(
+		`@loop
+0;JMP
+(LOOP)
+@LOOP
+0;JMP
+@loop`)
+
+	parser := NewParser(reader)
+	parser.Filename = "Foo.asm"
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("parser.Parse() results in error: %s", err)
+	}
+
+	wanted := `Foo.asm:1:1: warning: variable "loop" differs from label "LOOP" only by case, declared at Foo.asm:3:1`
+	if len(parser.Diagnostics) != 1 {
+		t.Fatalf("len(parser.Diagnostics) = %d, want 1", len(parser.Diagnostics))
+	}
+	if got := parser.Diagnostics[0].Error(); got != wanted {
+		t.Errorf("parser.Diagnostics[0] = %s, want %s", got, wanted)
+	}
+	if parser.Commands[0].SymbolInt != 16 {
+		t.Errorf("RAM Addr %d, but want 16", parser.Commands[0].SymbolInt)
+	}
+}
+
 func TestParser_parseACommandSymbolToInt(t *testing.T) {
 	reader := strings.NewReader(
 		`@i
@@ -171,6 +522,18 @@ D=D+A;JGT
 	}
 }
 
+func TestParser_parseACommandSymbolToInt_error(t *testing.T) {
+	reader := strings.NewReader(
+		`@32767
+@32768`)
+	parser := NewParser(reader)
+	parser.parseToCommands()
+
+	if err := parser.parseACommandSymbolToInt(); err == nil {
+		t.Errorf("parser.parseACommandSymbolToInt() should not be nil")
+	}
+}
+
 func TestParser_Advance(t *testing.T) {
 	commands := `@i
 D=D-A`
@@ -191,8 +554,48 @@ D=D-A`
 			t.Errorf("Advance() = %t, want %t", got, test.advance)
 		}
 
-		if parser.currentCommand != test.command  {
-			t.Errorf("currentCommand = %s, want %s", parser.currentCommand, test.command)
+		if got := joinTokens(parser.currentTokens); got != test.command  {
+			t.Errorf("currentTokens = %s, want %s", got, test.command)
+		}
+	}
+}
+
+func TestParser_Advance_comment(t *testing.T) {
+	commands := "// comment only line\r\n" +
+		"\r\n" +
+		"  \t \r\n" +
+		"\t@i // trailing comment\r\n" +
+		"D = D - A\t\r\n" +
+		"   // indented comment\r\n" +
+		"(LOOP)//comment\r\n"
+	reader := strings.NewReader(commands)
+	parser := NewParser(reader)
+
+	tests := []struct {
+		command string
+		text string
+		pos Position
+		advance bool
+	}{
+		{command: "@i", text: "@i", pos: Position{Line: 4, Column: 2}, advance: true},
+		{command: "D=D-A", text: "D = D - A", pos: Position{Line: 5, Column: 1}, advance: true},
+		{command: "(LOOP)", text: "(LOOP)", pos: Position{Line: 7, Column: 1}, advance: true},
+		{command: "", text: "", pos: Position{Line: 7, Column: 1}, advance: false},
+	}
+
+	for _, test := range tests {
+		if got := parser.Advance(); got != test.advance {
+			t.Errorf("Advance() = %t, want %t", got, test.advance)
+		}
+
+		if got := joinTokens(parser.currentTokens); got != test.command  {
+			t.Errorf("currentTokens = %s, want %s", got, test.command)
+		}
+		if parser.currentText != test.text  {
+			t.Errorf("currentText = %s, want %s", parser.currentText, test.text)
+		}
+		if parser.currentPos != test.pos  {
+			t.Errorf("currentPos = %s, want %s", parser.currentPos, test.pos)
 		}
 	}
 }
@@ -208,14 +611,103 @@ func TestParser_ParseOne(t *testing.T) {
 		{commandString: "D;JGT", command: Command{CommandType: CCommand, Dest: "", Comp: "D", Jump: "JGT"}},
 		{commandString: "D=D+A", command: Command{CommandType: CCommand, Dest: "D", Comp: "D+A", Jump: ""}},
 		{commandString: "D=D+A;JGT", command: Command{CommandType: CCommand, Dest: "D", Comp: "D+A", Jump: "JGT"}},
+		{commandString: "AM = M - 1 ; JNE", command: Command{CommandType: CCommand, Dest: "AM", Comp: "M-1", Jump: "JNE"}},
+		{commandString: ".equ N 4", command: Command{CommandType: EquCommand, Symbol: "N", Value: "4"}},
+		{commandString: ".define LAST END", command: Command{CommandType: EquCommand, Symbol: "LAST", Value: "END"}},
+		{commandString: ".equ LAST SCREEN + 8191", command: Command{CommandType: EquCommand, Symbol: "LAST", Value: "SCREEN+8191"}},
+		{commandString: "@SCREEN + 32 * row", command: Command{CommandType: ACommand, Symbol: "SCREEN+32*row"}},
+		{commandString: "@(KBD-1)", command: Command{CommandType: ACommand, Symbol: "(KBD-1)"}},
+		{commandString: "@0x4000", command: Command{CommandType: ACommand, Symbol: "0x4000"}},
+		{commandString: "@'A'", command: Command{CommandType: ACommand, Symbol: "'A'"}},
+		{commandString: "@-1", command: Command{CommandType: ACommand, Symbol: "-1"}},
+		{commandString: "", command: Command{}},
 	}
 
 	for _, test := range tests {
-		parser := Parser{}
-		parser.currentCommand = test.commandString
-		if got := parser.ParseOne(); got != test.command {
-			t.Errorf("ParseOne() = %+v, want %+v", got, test.command)
+		parser := newLineParser(test.commandString)
+		wanted := test.command
+		if !wanted.IsNil() {
+			wanted.Pos = Position{Line: 1, Column: 1}
+			wanted.Text = test.commandString
+		}
+		got, err := parser.ParseOne()
+		if err != nil {
+			t.Errorf("ParseOne() results in error: %s", err)
 		}
+		if got != wanted {
+			t.Errorf("ParseOne() = %+v, want %+v", got, wanted)
+		}
+	}
+}
+
+func TestParser_ParseOne_error(t *testing.T) {
+	tests := []struct {
+		commandString string
+		wanted string
+	}{
+		{commandString: "@i#", wanted: `1:3: unexpected character "#"`},
+		{commandString: "D=;;JMP", wanted: `1:4: multiple ";" in "D=;;JMP"`},
+		{commandString: "D=;JMP", wanted: `1:1: missing comp in "D=;JMP"`},
+		{commandString: ";JMP", wanted: `1:1: missing comp in ";JMP"`},
+		{commandString: "@", wanted: `1:2: missing symbol after @`},
+		{commandString: "@1abc", wanted: `1:2: symbol "1abc" must not start with a digit`},
+		{commandString: "@i j", wanted: `1:4: unexpected "j" after symbol "i"`},
+		{commandString: "@(i", wanted: `1:4: missing ) in expression`},
+		{commandString: "@(i j)", wanted: `1:5: unexpected "j" in expression, expected )`},
+		{commandString: "@i+", wanted: `1:4: missing operand after "+"`},
+		{commandString: "@i+2 j", wanted: `1:6: unexpected "j" after expression "i+2"`},
+		{commandString: "@i**2", wanted: `1:4: unexpected "*", expected symbol`},
+		{commandString: "@i < 2", wanted: `1:4: unexpected character "<"`},
+		{commandString: "@0xZZ", wanted: `1:2: invalid number "0xZZ"`},
+		{commandString: "@0b102", wanted: `1:2: invalid number "0b102"`},
+		{commandString: "@'AB'", wanted: `1:2: unexpected character "'"`},
+		{commandString: "('A')", wanted: `1:2: unexpected "'A'", expected symbol`},
+		{commandString: "(LOOP", wanted: `1:6: missing ) after label "LOOP"`},
+		{commandString: "()", wanted: `1:1: missing label name in "()"`},
+		{commandString: "(1LOOP)", wanted: `1:2: label "1LOOP" must not start with a digit`},
+		{commandString: "(100)", wanted: `1:2: label "100" must not start with a digit`},
+		{commandString: "(LOOP END)", wanted: `1:7: unexpected "END" in label, expected )`},
+		{commandString: "(LOOP))", wanted: `1:7: unexpected ")" after label`},
+		{commandString: "D=M;JMP;JGT", wanted: `1:8: multiple ";" in "D=M;JMP;JGT"`},
+		{commandString: "D=M=A", wanted: `1:4: multiple "=" in "D=M=A"`},
+		{commandString: "=M", wanted: `1:1: missing dest before "="`},
+		{commandString: "A D=M", wanted: `1:1: invalid dest "AD"`},
+		{commandString: "D;", wanted: `1:3: missing jump after ";"`},
+		{commandString: "D;J MP", wanted: `1:3: invalid jump "JMP"`},
+		{commandString: "D=(M)", wanted: `1:3: unexpected "(" in comp`},
+		{commandString: ".equ", wanted: `1:5: missing constant name after .equ`},
+		{commandString: ".equ N", wanted: `1:7: missing value of constant "N"`},
+		{commandString: ".equ 1N 4", wanted: `1:6: constant "1N" must not start with a digit`},
+		{commandString: ".equ @N 4", wanted: `1:6: unexpected "@", expected constant name`},
+		{commandString: ".equ N 4 5", wanted: `1:10: unexpected "5" after value of constant "N"`},
+		{commandString: ".equ N (4", wanted: `1:10: missing ) in expression`},
+		{commandString: ".equ N 4a", wanted: `1:8: symbol "4a" must not start with a digit`},
+	}
+
+	for _, test := range tests {
+		parser := newLineParser(test.commandString)
+		_, err := parser.ParseOne()
+		if err == nil {
+			t.Errorf("ParseOne() should return error for %q", test.commandString)
+			continue
+		}
+		if err.Error() != test.wanted {
+			t.Errorf("ParseOne() error = %s, want %s", err, test.wanted)
+		}
+	}
+}
+
+func TestParser_Advance_error(t *testing.T) {
+	parser := NewParser(&errReader{data: "@i\n", err: errors.New("disk failure")})
+
+	for parser.Advance() {
+	}
+
+	if parser.Err() == nil {
+		t.Errorf("parser.Err() should not be nil")
+	}
+	if err := parser.Parse(); err == nil {
+		t.Errorf("parser.Parse() should return reading error")
 	}
 }
 
@@ -227,11 +719,12 @@ func TestParser_commandType(t *testing.T) {
 		{command: "@100", wanted: ACommand},
 		{command: "(LOOP)", wanted: LCommand},
 		{command: "D=D-A", wanted: CCommand},
+		{command: ".equ N 4", wanted: EquCommand},
+		{command: ".define N 4", wanted: EquCommand},
 	}
 
 	for _, test := range tests {
-		parser := &Parser{}
-		parser.currentCommand = test.command
+		parser := newLineParser(test.command)
 		if got := parser.commandType(); got != test.wanted {
 			t.Errorf("commandType() = %s, want %s", got, test.wanted)
 		}
@@ -248,9 +741,12 @@ func TestParser_symbolFromACommand(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		parser := &Parser{}
-		parser.currentCommand = test.command
-		if got := parser.symbolFromACommand(); got != test.wanted {
+		parser := newLineParser(test.command)
+		got, err := parser.symbolFromACommand()
+		if err != nil {
+			t.Errorf("symbolFromACommand() results in error: %s", err)
+		}
+		if got != test.wanted {
 			t.Errorf("symbolFromACommand() = %s, want %s", got, test.wanted)
 		}
 	}
@@ -265,9 +761,12 @@ func TestParser_symbolFromLCommand(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		parser := &Parser{}
-		parser.currentCommand = test.command
-		if got := parser.symbolFromLCommand(); got != test.wanted {
+		parser := newLineParser(test.command)
+		got, err := parser.symbolFromLCommand()
+		if err != nil {
+			t.Errorf("symbolFromLCommand() results in error: %s", err)
+		}
+		if got != test.wanted {
 			t.Errorf("symbolFromLCommand() = %s, want %s", got, test.wanted)
 		}
 	}
@@ -286,9 +785,8 @@ func TestParser_destCompJump(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		parser := &Parser{}
-		parser.currentCommand = test.command
-		dest, comp, jump := parser.destCompJump()
+		parser := newLineParser(test.command)
+		dest, comp, jump, _ := parser.destCompJump()
 		if (dest != test.dest) || (comp != test.comp) || (jump != test.jump) {
 			t.Errorf(
 				"destCompJump() = %s, %s, %s, want %s, %s, %s",
@@ -296,3 +794,55 @@ func TestParser_destCompJump(t *testing.T) {
 		}
 	}
 }
+
+func TestParser_Parse_origin(t *testing.T) {
+	reader := strings.NewReader(`@1
+//# source Foo.vm:3
+@2
+D=A
+//# source Foo.vm:4:5
+@3
+//# source
+@4
+`)
+	parser := NewParser(reader)
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("parser.Parse() results in error: %s", err)
+	}
+
+	wanted := []Position{
+		{},
+		{File: "Foo.vm", Line: 3},
+		{File: "Foo.vm", Line: 3},
+		{File: "Foo.vm", Line: 4, Column: 5},
+		{},
+	}
+	for i, command := range parser.Commands {
+		if command.Origin != wanted[i] {
+			t.Errorf("parser.Commands[%d].Origin = %+v, want %+v", i, command.Origin, wanted[i])
+		}
+	}
+}
+
+func TestParseOriginComment(t *testing.T) {
+	tests := []struct {
+		comment string
+		wanted  Position
+		ok      bool
+	}{
+		{comment: "//# source Foo.vm:12", wanted: Position{File: "Foo.vm", Line: 12}, ok: true},
+		{comment: "//# source\tdir/Foo.vm:12:3 ", wanted: Position{File: "dir/Foo.vm", Line: 12, Column: 3}, ok: true},
+		{comment: "//# source C:\\Foo.vm:12", wanted: Position{File: "C:\\Foo.vm", Line: 12}, ok: true},
+		{comment: "//# source", wanted: Position{}, ok: true},
+		{comment: "//# source Foo.vm", ok: false},
+		{comment: "//# source :12", ok: false},
+		{comment: "//# sourcemap Foo.vm:12", ok: false},
+		{comment: "// source Foo.vm:12", ok: false},
+	}
+	for _, test := range tests {
+		got, ok := parseOriginComment(test.comment)
+		if got != test.wanted || ok != test.ok {
+			t.Errorf("parseOriginComment(%q) = %+v, %t, want %+v, %t", test.comment, got, ok, test.wanted, test.ok)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package assembler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// SymbolKind is the kind of Symbol.
+type SymbolKind string
+
+const (
+	LabelSymbol      SymbolKind = "label"
+	ConstantSymbol   SymbolKind = "constant"
+	VariableSymbol   SymbolKind = "variable"
+	PredefinedSymbol SymbolKind = "predefined"
+)
+
+// symbolKindOrder is the order of kinds in Symbols.
+var symbolKindOrder = map[SymbolKind]int{LabelSymbol: 0, ConstantSymbol: 1, VariableSymbol: 2, PredefinedSymbol: 3}
+
+// Symbol is a symbol of a program with its address.
+type Symbol struct {
+	Name string     `json:"name"`
+	Kind SymbolKind `json:"kind"`
+	// Address is the ROM address of a label, the value of a constant,
+	// or the RAM address of a variable or a predefined symbol
+	Address uint16 `json:"address"`
+	// Uses is the number of A commands using the symbol
+	Uses int `json:"uses"`
+}
+
+// Symbols returns labels, constants, variables and used predefined symbols of the program after Parse.
+// Labels come first, then constants, variables and predefined symbols, each in order of address.
+func (p *Parser) Symbols() []Symbol {
+	uses := map[string]int{}
+	for _, command := range p.Commands {
+		if command.CommandType != ACommand || isDecimal(command.Symbol) {
+			continue
+		}
+		if isSymbol(command.Symbol) {
+			uses[command.Symbol] += 1
+			continue
+		}
+		expr, err := parseExpressionText(command.Symbol, command.Pos)
+		if err != nil {
+			continue
+		}
+		used := map[string]bool{}
+		for _, name := range expr.symbols() {
+			if !used[name] {
+				used[name] = true
+				uses[name] += 1
+			}
+		}
+	}
+
+	var symbols []Symbol
+	for name, addr := range p.symbolTable {
+		symbol := Symbol{Name: name, Kind: VariableSymbol, Address: addr, Uses: uses[name]}
+		if _, ok := p.labels[name]; ok {
+			symbol.Kind = LabelSymbol
+		} else if _, ok := p.constants[name]; ok {
+			symbol.Kind = ConstantSymbol
+		} else if _, ok := predefinedSymbols[name]; ok {
+			if symbol.Uses == 0 {
+				continue
+			}
+			symbol.Kind = PredefinedSymbol
+		}
+		symbols = append(symbols, symbol)
+	}
+
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].Kind != symbols[j].Kind {
+			return symbolKindOrder[symbols[i].Kind] < symbolKindOrder[symbols[j].Kind]
+		}
+		if symbols[i].Address != symbols[j].Address {
+			return symbols[i].Address < symbols[j].Address
+		}
+		return symbols[i].Name < symbols[j].Name
+	})
+	return symbols
+}
+
+// WriteSymbolMap writes symbols as a table of name, kind, address and uses.
+func WriteSymbolMap(writer io.Writer, symbols []Symbol) error {
+	width := len("SYMBOL")
+	for _, symbol := range symbols {
+		if len(symbol.Name) > width {
+			width = len(symbol.Name)
+		}
+	}
+
+	buffered := bufio.NewWriter(writer)
+	fmt.Fprintf(buffered, "%-*s  %-10s  %7s  %s\n", width, "SYMBOL", "KIND", "ADDRESS", "USES")
+	for _, symbol := range symbols {
+		fmt.Fprintf(buffered, "%-*s  %-10s  %7d  %d\n", width, symbol.Name, symbol.Kind, symbol.Address, symbol.Uses)
+	}
+	return buffered.Flush()
+}
+
+// WriteSymbolMapJSON writes symbols as JSON: {"symbols": [{"name", "kind", "address", "uses"}, ...]}
+func WriteSymbolMapJSON(writer io.Writer, symbols []Symbol) error {
+	if symbols == nil {
+		symbols = []Symbol{}
+	}
+	data, err := json.MarshalIndent(struct {
+		Symbols []Symbol `json:"symbols"`
+	}{symbols}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(append(data, '\n'))
+	return err
+}
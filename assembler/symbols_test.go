@@ -0,0 +1,97 @@
+package assembler
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const symbolsProgram = `.equ ZERO 0
+@i
+M=0
+(LOOP)
+@i
+D=M
+@R0
+D=D-M
+@END
+D;JGE
+@i
+M=M+1
+@LOOP+ZERO
+0;JMP
+(END)
+@END
+0;JMP
+`
+
+func TestParser_Symbols(t *testing.T) {
+	parser := NewParser(strings.NewReader(symbolsProgram))
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("parser.Parse() results in error: %s", err)
+	}
+
+	wanted := []Symbol{
+		{Name: "LOOP", Kind: LabelSymbol, Address: 2, Uses: 1},
+		{Name: "END", Kind: LabelSymbol, Address: 12, Uses: 2},
+		{Name: "ZERO", Kind: ConstantSymbol, Address: 0, Uses: 1},
+		{Name: "i", Kind: VariableSymbol, Address: 16, Uses: 3},
+		{Name: "R0", Kind: PredefinedSymbol, Address: 0, Uses: 1},
+	}
+	if got := parser.Symbols(); !reflect.DeepEqual(got, wanted) {
+		t.Errorf("parser.Symbols() = %+v, want %+v", got, wanted)
+	}
+}
+
+func TestWriteSymbolMap(t *testing.T) {
+	symbols := []Symbol{
+		{Name: "LOOP", Kind: LabelSymbol, Address: 2, Uses: 1},
+		{Name: "counter", Kind: VariableSymbol, Address: 16, Uses: 3},
+	}
+
+	writer := new(bytes.Buffer)
+	if err := WriteSymbolMap(writer, symbols); err != nil {
+		t.Fatalf("WriteSymbolMap() results in error: %s", err)
+	}
+	wanted := `SYMBOL   KIND        ADDRESS  USES
+LOOP     label             2  1
+counter  variable         16  3
+`
+	if got := writer.String(); got != wanted {
+		t.Errorf("WriteSymbolMap() =\n%s\nwant\n%s", got, wanted)
+	}
+
+	writer.Reset()
+	if err := WriteSymbolMapJSON(writer, symbols); err != nil {
+		t.Fatalf("WriteSymbolMapJSON() results in error: %s", err)
+	}
+	wanted = `{
+  "symbols": [
+    {
+      "name": "LOOP",
+      "kind": "label",
+      "address": 2,
+      "uses": 1
+    },
+    {
+      "name": "counter",
+      "kind": "variable",
+      "address": 16,
+      "uses": 3
+    }
+  ]
+}
+`
+	if got := writer.String(); got != wanted {
+		t.Errorf("WriteSymbolMapJSON() =\n%s\nwant\n%s", got, wanted)
+	}
+
+	writer.Reset()
+	if err := WriteSymbolMapJSON(writer, nil); err != nil {
+		t.Fatalf("WriteSymbolMapJSON() results in error: %s", err)
+	}
+	if got := writer.String(); got != "{\n  \"symbols\": []\n}\n" {
+		t.Errorf("WriteSymbolMapJSON(nil) = %q, want empty symbols", got)
+	}
+}
@@ -7,13 +7,13 @@ import (
 	"strings"
 )
 
-func bitsMinMax(bitsLength int, unsigned bool) (int64, uint64) {
+func bitsMinMax(bitsLength int, unsigned bool) (int64, uint64, error) {
 	if bitsLength < 1 || bitsLength > 64 {
-		panic("bitsMinMax(): length should be between 1 and 64")
+		return 0, 0, errors.New("bitsMinMax(): length should be between 1 and 64")
 	}
 
 	if bitsLength == 1 && !unsigned {
-		panic("bitsMinMax(): singed 1 length is nonsense")
+		return 0, 0, errors.New("bitsMinMax(): singed 1 length is nonsense")
 	}
 
 	boundary := int64(1)
@@ -31,7 +31,7 @@ func bitsMinMax(bitsLength int, unsigned bool) (int64, uint64) {
 		max = uint64(boundary * 2 - 1)
 	}
 
-	return min, max
+	return min, max, nil
 }
 
 // IntToBitsConverter can be used to convert int string to bits string
@@ -70,7 +70,10 @@ func NewIntToBitsConverter(originalIntString string, bitsLength int, unsigned bo
 		return nil, errors.New("singed 1 length is nonsense")
 	}
 
-	min, max := bitsMinMax(bitsLength, unsigned)
+	min, max, err := bitsMinMax(bitsLength, unsigned)
+	if err != nil {
+		return nil, err
+	}
 
 	if unsigned {
 		if bits.originalUInt64 < uint64(min) || bits.originalUInt64 > max {
@@ -84,14 +87,17 @@ func NewIntToBitsConverter(originalIntString string, bitsLength int, unsigned bo
 	return bits, nil
 }
 
-func (b *IntToBitsConverter) ToBits() string {
+func (b *IntToBitsConverter) ToBits() (string, error) {
 	if !b.unsigned {
 		if b.originalInt64 < 0 {
 			// For negative integer -K, not(K-1) is binary expression of -K
 			// e.g. -5 -> not(5-1) -> not(4) -> Not(0010) -> 1101
 			integer := -b.originalInt64 - 1
 			bitsString := strconv.FormatInt(integer, 2)
-			bitsString = b.fillZerosToBits(bitsString)
+			bitsString, err := b.fillZerosToBits(bitsString)
+			if err != nil {
+				return "", err
+			}
 			return b.not(bitsString)
 		} else {
 			bitsString := strconv.FormatInt(b.originalInt64, 2)
@@ -103,17 +109,18 @@ func (b *IntToBitsConverter) ToBits() string {
 	}
 }
 
-func (b *IntToBitsConverter) fillZerosToBits(originalBits string) string {
+func (b *IntToBitsConverter) fillZerosToBits(originalBits string) (string, error) {
 	originalLength := len(originalBits)
 
 	lengthOfZeros := b.length - originalLength
 
 	if lengthOfZeros < 0 {
-		panic("length of originalBits should be smaller or equal than length")
+		return "", errors.New(fmt.Sprintf(
+			"length of %s should be smaller or equal than %d", originalBits, b.length))
 	}
 
 	if lengthOfZeros == 0 {
-		return originalBits
+		return originalBits, nil
 	}
 
 	var bitsArray = make([]string, b.length, b.length)
@@ -129,10 +136,10 @@ func (b *IntToBitsConverter) fillZerosToBits(originalBits string) string {
 		cursor += 1
 	}
 
-	return strings.Join(bitsArray, "")
+	return strings.Join(bitsArray, ""), nil
 }
 
-func (b *IntToBitsConverter) not(bits string) string {
+func (b *IntToBitsConverter) not(bits string) (string, error) {
 	length := len(bits)
 	var bitsArray = make([]string, length, length)
 
@@ -142,8 +149,8 @@ func (b *IntToBitsConverter) not(bits string) string {
 		} else if string(b) == "1" {
 			bitsArray[i] = "0"
 		} else {
-			panic(fmt.Sprintf("notBits() bits is not bits: %s", bits))
+			return "", errors.New(fmt.Sprintf("notBits() bits is not bits: %s", bits))
 		}
 	}
-	return strings.Join(bitsArray, "")
+	return strings.Join(bitsArray, ""), nil
 }
@@ -21,13 +21,33 @@ func Test_bitsMinMax(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		min, max := bitsMinMax(test.bitsLength, test.unsigned)
+		min, max, err := bitsMinMax(test.bitsLength, test.unsigned)
+		if err != nil {
+			t.Errorf("bitsMinMax() results in error: %s", err.Error())
+		}
 		if min != test.min || max != test.max {
 			t.Errorf("bitsMinMax() = %d, %d, want %d, %d", min, max, test.min, test.max)
 		}
 	}
 }
 
+func Test_bitsMinMax_error(t *testing.T) {
+	tests := []struct{
+		bitsLength int
+		unsigned bool
+	}{
+		{bitsLength: 0, unsigned: true},
+		{bitsLength: 65, unsigned: true},
+		{bitsLength: 1, unsigned: false},
+	}
+
+	for _, test := range tests {
+		if _, _, err := bitsMinMax(test.bitsLength, test.unsigned); err == nil {
+			t.Errorf("bitsMinMax() should return error: %+v", test)
+		}
+	}
+}
+
 func Test_NewBits(t *testing.T) {
 	tests := []struct{
 		intString string
@@ -114,7 +134,11 @@ func TestIntToBitsConverter_ToBits(t *testing.T) {
 		if err != nil {
 			t.Errorf("IntToBitsConverter.ToBits() results in error: %s", err.Error())
 		}
-		if got := converter.ToBits(); got != test.wanted {
+		got, err := converter.ToBits()
+		if err != nil {
+			t.Errorf("IntToBitsConverter.ToBits() results in error: %s", err.Error())
+		}
+		if got != test.wanted {
 			t.Errorf("IntToBitsConverter.ToBits() = %s, want %s", got, test.wanted)
 		}
 	}
@@ -133,7 +157,11 @@ func TestBits_not(t *testing.T) {
 
 	for _, test := range tests {
 		b := IntToBitsConverter{}
-		if got := b.not(test.bits); got != test.wanted {
+		got, err := b.not(test.bits)
+		if err != nil {
+			t.Errorf("notBits() results in error: %s", err.Error())
+		}
+		if got != test.wanted {
 			t.Errorf("notBits() = %s, want %s", got, test.wanted)
 		}
 	}
@@ -148,12 +176,27 @@ func TestBits_fillZerosToBits(t *testing.T) {
 	}{
 		{originalBits: "1010", length: 4, wanted: "1010", err: false},
 		{originalBits: "1010", length: 6, wanted: "001010", err: false},
+		{originalBits: "1010", length: 3, wanted: "", err: true},
 	}
 
 	for _, test := range tests {
 		bits := &IntToBitsConverter{length: test.length}
-		if got := bits.fillZerosToBits(test.originalBits); got != test.wanted {
+		got, err := bits.fillZerosToBits(test.originalBits)
+		if test.err && err == nil {
+			t.Errorf("IntToBitsConverter.fillZerosToBits() should return error: %+v", test)
+		}
+		if !test.err && err != nil {
+			t.Errorf("IntToBitsConverter.fillZerosToBits() results in error: %s", err.Error())
+		}
+		if got != test.wanted {
 			t.Errorf("IntToBitsConverter.fillZerosToBits() = %s, want %s", got, test.wanted)
 		}
 	}
 }
+
+func TestBits_not_error(t *testing.T) {
+	b := IntToBitsConverter{}
+	if _, err := b.not("0120"); err == nil {
+		t.Errorf("notBits() should return error for non bits string")
+	}
+}
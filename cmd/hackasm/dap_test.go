@@ -0,0 +1,24 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRun_dap(t *testing.T) {
+	request := `{"seq":1,"type":"request","command":"initialize","arguments":{}}`
+	stdin := strings.NewReader("Content-Length: " + strconv.Itoa(len(request)) + "\r\n\r\n" + request)
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"dap"}, stdin, stdout, stderr); code != 0 {
+		t.Fatalf("run() = %d, want 0, stderr: %s", code, stderr)
+	}
+	if !strings.HasPrefix(stdout.String(), "Content-Length: ") || !strings.Contains(stdout.String(), `"command":"initialize"`) {
+		t.Errorf("stdout = %q, want initialize response", stdout)
+	}
+
+	if code := run([]string{"dap", "Foo.asm"}, strings.NewReader(""), stdout, stderr); code != 2 {
+		t.Errorf("run() = %d, want 2", code)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fidemin/hack-assembler/assembler"
+	"github.com/fidemin/hack-assembler/debugger"
+)
+
+// runDebug executes hackasm debug with args and returns the process exit code.
+// Debugger commands are read from stdin.
+func runDebug(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("hackasm debug", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	maxCycles := flags.Int("max-cycles", 1000000, "stop continue after `n` cycles (0 for no limit)")
+	var include includePath
+	flags.Var(&include, "I", "search `dir` for included files after the directory of the including file")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: hackasm debug [-max-cycles n] [-I dir]... Foo.asm")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	if err := debug(flags.Arg(0), *maxCycles, include, stdin, stdout); err != nil {
+		var diagnostic *assembler.Diagnostic
+		if errors.As(err, &diagnostic) {
+			fmt.Fprintln(stderr, diagnostic)
+		} else {
+			fmt.Fprintf(stderr, "hackasm: %s\n", err)
+		}
+		return 1
+	}
+	return 0
+}
+
+func debug(input string, maxCycles int, include includePath, stdin io.Reader, stdout io.Writer) error {
+	file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	d, err := debugger.New(file, input, include...)
+	if err != nil {
+		return err
+	}
+	d.MaxCycles = maxCycles
+	fmt.Fprintln(stdout, `type "help" for commands`)
+	return d.Run(stdin, stdout)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_debug(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "Foo.asm")
+	if err := ioutil.WriteFile(input, []byte("@i\nM=1\n(END)\n@END\n0;JMP\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	stdin := strings.NewReader("break END\ncontinue\nprint i\nquit\n")
+	if code := run([]string{"debug", input}, stdin, stdout, stderr); code != 0 {
+		t.Fatalf("run() = %d, want 0, stderr: %s", code, stderr)
+	}
+	if !strings.Contains(stdout.String(), "breakpoint at 2\n") || !strings.Contains(stdout.String(), "i = 1\n") {
+		t.Errorf("stdout = %q, should stop at END and print i", stdout)
+	}
+}
+
+func TestRun_debugError(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "Foo.asm")
+	if err := ioutil.WriteFile(input, []byte("@i\nM=X\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"debug", input}, strings.NewReader(""), stdout, stderr); code != 1 {
+		t.Errorf("run() = %d, want 1", code)
+	}
+	if !strings.HasPrefix(stderr.String(), input+":2:") {
+		t.Errorf("stderr = %q, should have the position of the error", stderr)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/fidemin/hack-assembler/assembler"
+	"github.com/fidemin/hack-assembler/disassembler"
+)
+
+// disasmOptions are the command line options of hackasm disasm.
+type disasmOptions struct {
+	input  string
+	output string
+	format string
+	labels bool
+}
+
+// runDisasm executes hackasm disasm with args and returns the process exit code.
+func runDisasm(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	opts := disasmOptions{}
+	flags := flag.NewFlagSet("hackasm disasm", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.output, "o", "-", "write assembly to `file` (\"-\" for stdout)")
+	flags.StringVar(&opts.format, "format", "", "machine code `format`, guessed from the extension of input by default")
+	flags.BoolVar(&opts.labels, "labels", false, "replace addresses of jump targets with labels")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: hackasm disasm [-o output] [-format name] [-labels] Foo.hack")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	opts.input = flags.Arg(0)
+
+	if err := disassemble(opts, stdin, stdout, stderr); err != nil {
+		fmt.Fprintf(stderr, "hackasm: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// disassemble reads machine code from input and writes its assembly to output.
+// Words which are not hack commands are reported to stderr.
+func disassemble(opts disasmOptions, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	format, err := disasmFormat(opts)
+	if err != nil {
+		return err
+	}
+	reader, ok := format.(assembler.FormatReader)
+	if !ok {
+		return errors.New(fmt.Sprintf("format %s cannot be disassembled", format.Name()))
+	}
+
+	input := stdin
+	if opts.input != "-" {
+		file, err := os.Open(opts.input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+	words, err := reader.Read(input)
+	if err != nil {
+		return errors.New(fmt.Sprintf("%s: %s", displayName(opts.input), err))
+	}
+
+	assembly := new(bytes.Buffer)
+	disasm := disassembler.New(words, assembly)
+	disasm.Labels = opts.labels
+	if err := disasm.WriteAssembly(); err != nil {
+		return err
+	}
+	for _, addr := range disasm.Invalid {
+		fmt.Fprintf(stderr, "%s: warning: word %d is not a hack command\n", displayName(opts.input), addr)
+	}
+
+	if opts.output == "-" {
+		_, err := stdout.Write(assembly.Bytes())
+		return err
+	}
+	return ioutil.WriteFile(opts.output, assembly.Bytes(), 0644)
+}
+
+// disasmFormat returns the format of -format, or the format of the input extension.
+// Stdin is hack format unless -format is given.
+func disasmFormat(opts disasmOptions) (assembler.Format, error) {
+	if opts.format != "" {
+		return assembler.LookupFormat(opts.format)
+	}
+	if opts.input == "-" {
+		return assembler.HackFormat, nil
+	}
+	format, err := assembler.LookupFormatByExtension(filepath.Ext(opts.input))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: %s, use -format", opts.input, err))
+	}
+	return format, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_disasm(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "Foo.hex")
+	// @2 0;JMP in Intel HEX
+	if err := ioutil.WriteFile(input, []byte(":040000000002EA8789\n:00000001FF\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"disasm", "-labels", input}, strings.NewReader(""), stdout, stderr); code != 0 {
+		t.Fatalf("run() = %d, want 0, stderr: %s", code, stderr)
+	}
+	if wanted := "@L2\n0;JMP\n(L2)\n"; stdout.String() != wanted {
+		t.Errorf("stdout = %q, want %q", stdout, wanted)
+	}
+}
+
+func TestRun_disasmInvalid(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	stdin := strings.NewReader("0000000000000010\n1110000001000000\n")
+	if code := run([]string{"disasm", "-"}, stdin, stdout, stderr); code != 0 {
+		t.Fatalf("run() = %d, want 0, stderr: %s", code, stderr)
+	}
+	if !strings.Contains(stdout.String(), "// invalid: 1110000001000000") {
+		t.Errorf("stdout = %q, should flag the invalid word", stdout)
+	}
+	if wanted := "<stdin>: warning: word 1 is not a hack command\n"; stderr.String() != wanted {
+		t.Errorf("stderr = %q, want %q", stderr, wanted)
+	}
+}
+
+func TestRun_disasmError(t *testing.T) {
+	tests := []struct {
+		args   []string
+		stdin  string
+		wanted int
+	}{
+		// no input
+		{args: []string{"disasm"}, wanted: 2},
+		// source code literals cannot be read
+		{args: []string{"disasm", "-format", "go", "-"}, wanted: 1},
+		{args: []string{"disasm", "-"}, stdin: "0102\n", wanted: 1},
+		{args: []string{"disasm", "Foo.pdf"}, wanted: 1},
+		// readmemb or readmemh
+		{args: []string{"disasm", "Foo.mem"}, wanted: 1},
+	}
+
+	for _, test := range tests {
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		if code := run(test.args, strings.NewReader(test.stdin), stdout, stderr); code != test.wanted {
+			t.Errorf("run(%v) = %d, want %d", test.args, code, test.wanted)
+		}
+		if stderr.Len() == 0 {
+			t.Errorf("run(%v) should print error to stderr", test.args)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/fidemin/hack-assembler/lsp"
+)
+
+// runLSP serves Language Server Protocol over stdin and stdout and returns the process exit code.
+func runLSP(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) != 0 {
+		fmt.Fprintln(stderr, "usage: hackasm lsp")
+		return 2
+	}
+	if err := lsp.NewServer(stdin, stdout).Serve(); err != nil {
+		fmt.Fprintf(stderr, "hackasm: %s\n", err)
+		return 1
+	}
+	return 0
+}
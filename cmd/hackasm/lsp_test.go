@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRun_lsp(t *testing.T) {
+	var input strings.Builder
+	for _, request := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	} {
+		input.WriteString("Content-Length: " + strconv.Itoa(len(request)) + "\r\n\r\n" + request)
+	}
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"lsp"}, strings.NewReader(input.String()), stdout, stderr); code != 0 {
+		t.Fatalf("run() = %d, want 0, stderr: %s", code, stderr)
+	}
+	if !strings.Contains(stdout.String(), `"capabilities"`) {
+		t.Errorf("stdout = %q, want initialize response", stdout)
+	}
+
+	// exit without shutdown
+	exit := `{"jsonrpc":"2.0","method":"exit"}`
+	stdin := strings.NewReader("Content-Length: " + strconv.Itoa(len(exit)) + "\r\n\r\n" + exit)
+	if code := run([]string{"lsp"}, stdin, stdout, stderr); code != 1 {
+		t.Errorf("run() = %d, want 1", code)
+	}
+}
@@ -0,0 +1,290 @@
+// Command hackasm translates Hack assembly programs into Hack machine code.
+//
+// Usage:
+//
+//	hackasm [-o output] [-format name] [-max-errors n] [-listing file] [-map file]
+//	        [-sourcemap file] [-I dir]... Foo.asm
+//
+// Foo.asm is assembled into Foo.hack next to it unless -o is given.
+// Use "-" as input to read the program from stdin. The machine code is then
+// written to stdout unless -o is given. "-o -" always writes to stdout.
+//
+// -format selects another encoding of the machine code: bin, ihex, readmemb,
+// readmemh, logisim, go or c. The default output then has the extension of
+// the format, e.g. Foo.hex for ihex.
+//
+// All errors and warnings of the program are printed to stderr, up to
+// -max-errors errors.
+//
+// -listing writes a listing of the program: ROM address, machine code in
+// binary and hex, and source line of every source line, followed by the
+// symbol table.
+//
+// -map writes labels with ROM addresses, variables with RAM addresses and the
+// predefined symbols used, with the number of uses of each symbol. It is
+// written in JSON when the file has .json extension.
+//
+// -sourcemap writes the source file, line and column of the command at every
+// ROM address in JSON, as documented in package sourcemap. Commands after a
+// "//# source Foo.vm:12" comment also map to that line of the .vm file.
+//
+// Files of `.include "math.asm"` are searched in the directory of the
+// including file, and then in the directories given by -I in order.
+//
+// The disasm subcommand translates machine code back into assembly:
+//
+//	hackasm disasm [-o output] [-format name] [-labels] Foo.hack
+//
+// The assembly is written to stdout unless -o is given. The format of the
+// machine code is guessed from the extension of the input unless -format is
+// given, and .mem files of readmemb and readmemh need -format. -labels
+// replaces addresses of jump targets with labels like L4.
+// Words which are not hack commands are written as comments and reported to
+// stderr.
+//
+// The test subcommand runs Nand2Tetris test scripts with the emulator:
+//
+//	hackasm test [-I dir]... Foo.tst...
+//
+// .asm files loaded by the scripts are assembled by this assembler. The
+// output of a script is compared with its compare-to file, and the first
+// mismatching line is reported.
+//
+// The debug subcommand runs a program in an interactive debugger with
+// breakpoints on labels and source lines, watchpoints on RAM and printing of
+// registers, RAM and variables:
+//
+//	hackasm debug [-max-cycles n] [-I dir]... Foo.asm
+//
+// The dap subcommand serves Debug Adapter Protocol over stdin and stdout for
+// debugging in editors. The program to debug is given by the launch request.
+//
+// The lsp subcommand serves Language Server Protocol over stdin and stdout
+// with diagnostics, go to definition, references, hover, completion and
+// rename of labels.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fidemin/hack-assembler/assembler"
+	"github.com/fidemin/hack-assembler/sourcemap"
+)
+
+// options are the command line options of hackasm.
+type options struct {
+	input     string
+	output    string
+	format    string
+	maxErrors int
+	listing   string
+	symbolMap string
+	sourceMap string
+	include   includePath
+}
+
+// includePath is the directories of -I flags, which can be given many times.
+type includePath []string
+
+func (p *includePath) String() string {
+	return strings.Join(*p, string(filepath.ListSeparator))
+}
+
+func (p *includePath) Set(dir string) error {
+	*p = append(*p, filepath.ToSlash(dir))
+	return nil
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes hackasm with args and returns the process exit code.
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "disasm":
+			return runDisasm(args[1:], stdin, stdout, stderr)
+		case "test":
+			return runTest(args[1:], stdout, stderr)
+		case "debug":
+			return runDebug(args[1:], stdin, stdout, stderr)
+		case "dap":
+			return runDAP(args[1:], stdin, stdout, stderr)
+		case "lsp":
+			return runLSP(args[1:], stdin, stdout, stderr)
+		}
+	}
+
+	opts := options{}
+	flags := flag.NewFlagSet("hackasm", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.output, "o", "", "write machine code to `file` (\"-\" for stdout)")
+	flags.StringVar(&opts.format, "format", "hack", "machine code `format`: "+formatNames())
+	flags.IntVar(&opts.maxErrors, "max-errors", 10, "stop after `n` errors (0 for no limit)")
+	flags.StringVar(&opts.listing, "listing", "", "write listing with addresses, machine code and source to `file`")
+	flags.StringVar(&opts.symbolMap, "map", "", "write symbols with addresses and uses to `file`, in JSON for .json")
+	flags.StringVar(&opts.sourceMap, "sourcemap", "", "write JSON source map from ROM addresses to source lines to `file`")
+	flags.Var(&opts.include, "I", "search `dir` for included files after the directory of the including file")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: hackasm [-o output] [-format name] [-max-errors n] [-listing file] [-map file] [-sourcemap file] [-I dir]... Foo.asm")
+		fmt.Fprintln(stderr, "       hackasm disasm [-o output] [-format name] [-labels] Foo.hack")
+		fmt.Fprintln(stderr, "       hackasm test [-I dir]... Foo.tst...")
+		fmt.Fprintln(stderr, "       hackasm debug [-max-cycles n] [-I dir]... Foo.asm")
+		fmt.Fprintln(stderr, "       hackasm dap")
+		fmt.Fprintln(stderr, "       hackasm lsp")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	opts.input = flags.Arg(0)
+
+	if err := assemble(opts, stdin, stdout, stderr); err != nil {
+		var diagnostics assembler.Diagnostics
+		if errors.As(err, &diagnostics) {
+			fmt.Fprintln(stderr, diagnostics)
+		} else {
+			fmt.Fprintf(stderr, "hackasm: %s\n", err)
+		}
+		return 1
+	}
+	return 0
+}
+
+// assemble reads the program from input and writes its machine code to output.
+// Nothing is written when the program cannot be assembled. Warnings are printed to stderr.
+func assemble(opts options, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	format, err := assembler.LookupFormat(opts.format)
+	if err != nil {
+		return err
+	}
+
+	input, output := opts.input, opts.output
+	if output == "" {
+		output = defaultOutput(input, format)
+	}
+	if input != "-" && output != "-" && filepath.Clean(input) == filepath.Clean(output) {
+		return errors.New(fmt.Sprintf("%s: output would overwrite input", input))
+	}
+	for _, file := range []string{opts.listing, opts.symbolMap, opts.sourceMap} {
+		if input != "-" && file != "" && filepath.Clean(input) == filepath.Clean(file) {
+			return errors.New(fmt.Sprintf("%s: %s would overwrite input", input, file))
+		}
+	}
+
+	reader := stdin
+	if input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	code := new(bytes.Buffer)
+	asm := assembler.New(reader, code)
+	asm.Filename = filepath.ToSlash(displayName(input))
+	asm.FS = assembler.OSFS
+	asm.IncludePath = opts.include
+	asm.Recover = true
+	asm.MaxErrors = opts.maxErrors
+	asm.Format = format
+	listing := new(bytes.Buffer)
+	if opts.listing != "" {
+		asm.Listing = listing
+	}
+	if err := asm.WriteBinaryCode(); err != nil {
+		return err
+	}
+	if len(asm.Diagnostics) > 0 {
+		fmt.Fprintln(stderr, asm.Diagnostics)
+	}
+	if opts.listing != "" {
+		if err := ioutil.WriteFile(opts.listing, listing.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	if opts.symbolMap != "" {
+		if err := writeSymbolMap(opts.symbolMap, asm.Parser.Symbols()); err != nil {
+			return err
+		}
+	}
+	if opts.sourceMap != "" {
+		if err := writeSourceMap(opts.sourceMap, asm.Parser.Commands, output); err != nil {
+			return err
+		}
+	}
+
+	if output == "-" {
+		_, err := stdout.Write(code.Bytes())
+		return err
+	}
+	return ioutil.WriteFile(output, code.Bytes(), 0644)
+}
+
+// writeSymbolMap writes symbols to file, in JSON for .json file and in text otherwise.
+func writeSymbolMap(file string, symbols []assembler.Symbol) error {
+	buf := new(bytes.Buffer)
+	var err error
+	if filepath.Ext(file) == ".json" {
+		err = assembler.WriteSymbolMapJSON(buf, symbols)
+	} else {
+		err = assembler.WriteSymbolMap(buf, symbols)
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, buf.Bytes(), 0644)
+}
+
+// writeSourceMap writes the source map of commands assembled into output to file.
+func writeSourceMap(file string, commands []assembler.Command, output string) error {
+	name := ""
+	if output != "-" {
+		name = filepath.Base(output)
+	}
+	buf := new(bytes.Buffer)
+	if err := sourcemap.New(commands, name).Write(buf); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, buf.Bytes(), 0644)
+}
+
+// defaultOutput returns Foo.hack for Foo.asm in hack format and stdout for stdin.
+func defaultOutput(input string, format assembler.Format) string {
+	if input == "-" {
+		return "-"
+	}
+	return strings.TrimSuffix(input, filepath.Ext(input)) + format.Extension()
+}
+
+// formatNames returns names of all formats separated by comma.
+func formatNames() string {
+	var names []string
+	for _, format := range assembler.Formats() {
+		names = append(names, format.Name())
+	}
+	return strings.Join(names, ", ")
+}
+
+func displayName(input string) string {
+	if input == "-" {
+		return "<stdin>"
+	}
+	return input
+}
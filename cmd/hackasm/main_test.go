@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_file(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "Foo.asm")
+	if err := ioutil.WriteFile(input, []byte("@14\nD;JGT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{input}, strings.NewReader(""), stdout, stderr); code != 0 {
+		t.Fatalf("run() = %d, want 0, stderr: %s", code, stderr)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(dir, "Foo.hack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted := "0000000000001110\n1110001100000001\n"
+	if string(got) != wanted {
+		t.Errorf("Foo.hack = %q, want %q", got, wanted)
+	}
+}
+
+func TestRun_output(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "out.hack")
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	code := run([]string{"-o", output, "-"}, strings.NewReader("@14\n"), stdout, stderr)
+	if code != 0 {
+		t.Fatalf("run() = %d, want 0, stderr: %s", code, stderr)
+	}
+
+	got, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "0000000000001110\n" {
+		t.Errorf("out.hack = %q, want %q", got, "0000000000001110\n")
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("stdout = %q, want empty", stdout)
+	}
+}
+
+func TestRun_format(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "Foo.asm")
+	if err := ioutil.WriteFile(input, []byte("@14\nD;JGT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"-format", "readmemh", input}, strings.NewReader(""), stdout, stderr); code != 0 {
+		t.Fatalf("run() = %d, want 0, stderr: %s", code, stderr)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(dir, "Foo.mem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "000e\ne301\n" {
+		t.Errorf("Foo.mem = %q, want %q", got, "000e\ne301\n")
+	}
+}
+
+func TestRun_stdinToStdout(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"-"}, strings.NewReader("@14\n"), stdout, stderr); code != 0 {
+		t.Fatalf("run() = %d, want 0, stderr: %s", code, stderr)
+	}
+	if got := stdout.String(); got != "0000000000001110\n" {
+		t.Errorf("stdout = %q, want %q", got, "0000000000001110\n")
+	}
+}
+
+func TestRun_listing(t *testing.T) {
+	dir := t.TempDir()
+	listing := filepath.Join(dir, "Foo.lst")
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	code := run([]string{"-listing", listing, "-"}, strings.NewReader("(LOOP)\n@LOOP\n"), stdout, stderr)
+	if code != 0 {
+		t.Fatalf("run() = %d, want 0, stderr: %s", code, stderr)
+	}
+
+	got, err := ioutil.ReadFile(listing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "    0  0000000000000000  0000     2  @LOOP\n") {
+		t.Errorf("Foo.lst = %q, should have @LOOP at ROM address 0", got)
+	}
+	if stdout.String() != "0000000000000000\n" {
+		t.Errorf("stdout = %q, want machine code", stdout)
+	}
+}
+
+func TestRun_map(t *testing.T) {
+	dir := t.TempDir()
+	source := "(LOOP)\n@i\n@SCREEN\n@LOOP\n0;JMP\n"
+
+	tests := []struct {
+		file   string
+		wanted string
+	}{
+		{file: "Foo.map", wanted: "SYMBOL  KIND        ADDRESS  USES\n" +
+			"LOOP    label             0  1\n" +
+			"i       variable         16  1\n" +
+			"SCREEN  predefined    16384  1\n"},
+		{file: "Foo.json", wanted: `"name": "SCREEN",` + "\n" + `      "kind": "predefined",`},
+	}
+	for _, test := range tests {
+		file := filepath.Join(dir, test.file)
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		if code := run([]string{"-map", file, "-"}, strings.NewReader(source), stdout, stderr); code != 0 {
+			t.Fatalf("run() = %d, want 0, stderr: %s", code, stderr)
+		}
+		got, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(got), test.wanted) {
+			t.Errorf("%s = %q, should contain %q", test.file, got, test.wanted)
+		}
+	}
+}
+
+func TestRun_sourceMap(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "Foo.asm")
+	if err := ioutil.WriteFile(input, []byte("//# source Foo.vm:3\n@7\nD=A\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "Foo.map.json")
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"-sourcemap", file, input}, strings.NewReader(""), stdout, stderr); code != 0 {
+		t.Fatalf("run() = %d, want 0, stderr: %s", code, stderr)
+	}
+	got, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, wanted := range []string{`"file": "Foo.hack"`, `"address": 1,`, `"origin": {`} {
+		if !strings.Contains(string(got), wanted) {
+			t.Errorf("Foo.map.json = %q, should contain %q", got, wanted)
+		}
+	}
+}
+
+func TestRun_include(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"src/Foo.asm":   ".include \"lib.asm\"\n.include \"io.asm\"\n",
+		"src/lib.asm":   "@14\n",
+		"std/io.asm":    "D;JGT\n",
+		"std/error.asm": "D=X\n",
+	}
+	for name, data := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	input, std := filepath.Join(dir, "src", "Foo.asm"), filepath.Join(dir, "std")
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"-o", "-", "-I", std, input}, strings.NewReader(""), stdout, stderr); code != 0 {
+		t.Fatalf("run() = %d, want 0, stderr: %s", code, stderr)
+	}
+	if got, wanted := stdout.String(), "0000000000001110\n1110001100000001\n"; got != wanted {
+		t.Errorf("run() stdout = %q, want %q", got, wanted)
+	}
+
+	// errors of included files have their paths
+	stdout, stderr = new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"-o", "-", "-I", std, "-"}, strings.NewReader(".include \"error.asm\"\n"), stdout, stderr); code != 1 {
+		t.Fatalf("run() = %d, want 1", code)
+	}
+	if got, wanted := stderr.String(), filepath.ToSlash(std)+"/error.asm:1:1: unknown comp \"X\"\n"; got != wanted {
+		t.Errorf("run() stderr = %q, want %q", got, wanted)
+	}
+}
+
+func TestRun_diagnostic(t *testing.T) {
+	tests := []struct {
+		args   []string
+		wanted string
+	}{
+		{args: []string{"-"}, wanted: "<stdin>:2:1: unknown comp \"X\"\n<stdin>:3:1: unknown jump \"JJ\"\n"},
+		{args: []string{"-max-errors", "1", "-"}, wanted: "<stdin>:2:1: unknown comp \"X\"\n<stdin>:2:1: too many errors\n"},
+	}
+
+	for _, test := range tests {
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		if code := run(test.args, strings.NewReader("@1\nD=X\n0;JJ\n"), stdout, stderr); code != 1 {
+			t.Fatalf("run(%q) = %d, want 1", test.args, code)
+		}
+		if got := stderr.String(); got != test.wanted {
+			t.Errorf("run(%q) stderr = %q, want %q", test.args, got, test.wanted)
+		}
+	}
+}
+
+func TestRun_warning(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	code := run([]string{"-"}, strings.NewReader("(LOOP)\n@loop\n0;JMP\n"), stdout, stderr)
+	if code != 0 {
+		t.Fatalf("run() = %d, want 0, stderr: %s", code, stderr)
+	}
+	wanted := "<stdin>:2:1: warning: variable \"loop\" differs from label \"LOOP\" only by case, declared at <stdin>:1:1\n"
+	if got := stderr.String(); got != wanted {
+		t.Errorf("stderr = %q, want %q", got, wanted)
+	}
+	if stdout.Len() == 0 {
+		t.Errorf("stdout should have machine code")
+	}
+}
+
+func TestRun_error(t *testing.T) {
+	tests := []struct {
+		args  []string
+		stdin string
+		code  int
+	}{
+		{args: []string{}, code: 2},
+		{args: []string{"a.asm", "b.asm"}, code: 2},
+		{args: []string{"-"}, stdin: "D=X\n", code: 1},
+		{args: []string{"-format", "pdf", "-"}, stdin: "@1\n", code: 1},
+		{args: []string{filepath.Join(t.TempDir(), "missing.asm")}, code: 1},
+	}
+
+	for _, test := range tests {
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		if code := run(test.args, strings.NewReader(test.stdin), stdout, stderr); code != test.code {
+			t.Errorf("run(%q) = %d, want %d", test.args, code, test.code)
+		}
+		if stderr.Len() == 0 {
+			t.Errorf("run(%q) should print a message to stderr", test.args)
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("run(%q) should not write to stdout, got %q", test.args, stdout)
+		}
+	}
+}
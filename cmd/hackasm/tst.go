@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fidemin/hack-assembler/tst"
+)
+
+// runTest executes hackasm test with args and returns the process exit code.
+func runTest(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("hackasm test", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var include includePath
+	flags.Var(&include, "I", "search `dir` for files included by .asm programs")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: hackasm test [-I dir]... Foo.tst...")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	code := 0
+	for _, script := range flags.Args() {
+		if err := runScript(script, include, stdout); err != nil {
+			fmt.Fprintf(stderr, "FAIL %s\n%s\n", script, err)
+			code = 1
+			continue
+		}
+		fmt.Fprintf(stdout, "ok   %s\n", script)
+	}
+	return code
+}
+
+// runScript runs the test script. Echo of the script is written to stdout.
+func runScript(script string, include includePath, stdout io.Writer) error {
+	file, err := os.Open(script)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	runner := tst.New(file, script)
+	runner.Echo = stdout
+	runner.IncludePath = include
+	return runner.Run()
+}
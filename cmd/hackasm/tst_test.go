@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_test(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Add.asm":  "@2\nD=A\n@3\nD=D+A\n@0\nM=D\n",
+		"Add.tst":  "load Add.asm, compare-to Add.cmp, output-list RAM[0]%D2.6.2;\nrepeat 6 { ticktock; } output;\n",
+		"Add.cmp":  "|  RAM[0]  |\n|       5  |\n",
+		"Fail.tst": "load Add.asm, compare-to Fail.cmp, output-list RAM[0]%D2.6.2;\nrepeat 6 { ticktock; } output;\n",
+		"Fail.cmp": "|  RAM[0]  |\n|       6  |\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"test", filepath.Join(dir, "Add.tst")}, strings.NewReader(""), stdout, stderr); code != 0 {
+		t.Fatalf("run() = %d, want 0, stderr: %s", code, stderr)
+	}
+	if !strings.HasPrefix(stdout.String(), "ok ") {
+		t.Errorf("stdout = %q, should report ok", stdout)
+	}
+
+	stdout.Reset()
+	code := run([]string{"test", filepath.Join(dir, "Add.tst"), filepath.Join(dir, "Fail.tst")}, strings.NewReader(""), stdout, stderr)
+	if code != 1 {
+		t.Errorf("run() = %d, want 1", code)
+	}
+	if !strings.Contains(stderr.String(), "Fail.cmp:2: comparison failure") {
+		t.Errorf("stderr = %q, should report the mismatching line", stderr)
+	}
+}
+
+func TestRun_testInclude(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib")
+	files := map[string]string{
+		"Add.asm":     ".include \"const.asm\"\n.include \"add.asm\"\n",
+		"const.asm":   "@2\nD=A\n",
+		"lib/add.asm": "@3\nD=D+A\n@0\nM=D\n",
+		"Add.tst":     "load Add.asm, compare-to Add.cmp, output-list RAM[0]%D2.6.2;\nrepeat 6 { ticktock; } output;\n",
+		"Add.cmp":     "|  RAM[0]  |\n|       5  |\n",
+	}
+	if err := os.Mkdir(lib, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"test", "-I", lib, filepath.Join(dir, "Add.tst")}, strings.NewReader(""), stdout, stderr); code != 0 {
+		t.Fatalf("run() = %d, want 0, stderr: %s", code, stderr)
+	}
+}
@@ -0,0 +1,411 @@
+// Package dap is a Debug Adapter Protocol server for hack assembly programs.
+//
+// It supports launch with "program" (path of .asm file), "stopOnEntry", "maxCycles" and "includePath" arguments,
+// line breakpoints, stepping, and registers and variables of the program as DAP variables.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/fidemin/hack-assembler/debugger"
+	"github.com/fidemin/hack-assembler/emulator"
+	"github.com/fidemin/hack-assembler/internal/wire"
+)
+
+// threadID is the only thread of hack CPU.
+const threadID = 1
+
+// variablesReference of scopes
+const (
+	registersReference = 1
+	variablesReference = 2
+)
+
+// defaultMaxCycles stops continue of a program which does not halt.
+const defaultMaxCycles = 1000000
+
+// Message is a request, response or event of DAP.
+type Message struct {
+	Seq  int    `json:"seq"`
+	Type string `json:"type"`
+	// Command is set for request and response
+	Command   string          `json:"command,omitempty"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	// RequestSeq, Success and Message are set for response
+	RequestSeq int    `json:"request_seq,omitempty"`
+	Success    *bool  `json:"success,omitempty"`
+	Message    string `json:"message,omitempty"`
+	// Event is set for event
+	Event string          `json:"event,omitempty"`
+	Body  json.RawMessage `json:"body,omitempty"`
+}
+
+// Server serves a debug session over reader and writer, e.g. stdin and stdout.
+type Server struct {
+	reader *bufio.Reader
+	writer io.Writer
+	seq    int
+
+	debugger  *debugger.Debugger
+	program   string
+	maxCycles int
+	// breakpoints are ROM addresses
+	breakpoints map[uint16]bool
+	stopOnEntry bool
+	terminated  bool
+}
+
+// NewServer returns *Server reading requests from reader and writing responses and events to writer.
+func NewServer(reader io.Reader, writer io.Writer) *Server {
+	return &Server{
+		reader:      bufio.NewReader(reader),
+		writer:      writer,
+		breakpoints: map[uint16]bool{},
+	}
+}
+
+// Serve handles requests until disconnect request or the end of reader.
+func (s *Server) Serve() error {
+	for {
+		content, err := wire.Read(s.reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var request Message
+		if err := json.Unmarshal(content, &request); err != nil {
+			return errors.New(fmt.Sprintf("invalid message: %s", err))
+		}
+		if request.Type != "request" {
+			continue
+		}
+
+		body, err := s.handle(request)
+		if err != nil {
+			if err := s.respondError(request, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.respond(request, body); err != nil {
+			return err
+		}
+		if err := s.after(request); err != nil {
+			return err
+		}
+		if request.Command == "disconnect" || request.Command == "terminate" {
+			return nil
+		}
+	}
+}
+
+type source struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type breakpoint struct {
+	Verified bool   `json:"verified"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Source   source `json:"source"`
+}
+
+type stackFrame struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Source source `json:"source"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+type scope struct {
+	Name               string `json:"name"`
+	VariablesReference int    `json:"variablesReference"`
+	Expensive          bool   `json:"expensive"`
+}
+
+type variable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+// handle handles request and returns the body of its response.
+func (s *Server) handle(request Message) (interface{}, error) {
+	switch request.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+		}, nil
+	case "launch":
+		return nil, s.launch(request.Arguments)
+	case "setBreakpoints":
+		return s.setBreakpoints(request.Arguments)
+	case "pause", "disconnect", "terminate":
+		return nil, nil
+	case "threads":
+		return map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": threadID, "name": "hack"}},
+		}, nil
+	}
+
+	if s.debugger == nil {
+		return nil, errors.New(fmt.Sprintf("%s before launch", request.Command))
+	}
+	switch request.Command {
+	case "configurationDone":
+		return nil, nil
+	case "stackTrace":
+		return map[string]interface{}{"stackFrames": s.stackFrames(), "totalFrames": 1}, nil
+	case "scopes":
+		return map[string]interface{}{"scopes": []scope{
+			{Name: "Registers", VariablesReference: registersReference},
+			{Name: "Variables", VariablesReference: variablesReference},
+		}}, nil
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"variables": s.variables(args.VariablesReference)}, nil
+	case "continue":
+		return map[string]interface{}{"allThreadsContinued": true}, nil
+	case "next", "stepIn", "stepOut":
+		return nil, nil
+	}
+	return nil, errors.New(fmt.Sprintf("unsupported request %q", request.Command))
+}
+
+// after runs the program after the response of request, and sends events.
+func (s *Server) after(request Message) error {
+	switch request.Command {
+	case "launch":
+		// breakpoints are set after initialized event
+		return s.sendEvent("initialized", nil)
+	}
+
+	// the program is run only after it is launched
+	if s.debugger == nil {
+		return nil
+	}
+	switch request.Command {
+	case "configurationDone":
+		if s.stopOnEntry {
+			return s.sendStopped("entry", "")
+		}
+		return s.run(true)
+	case "continue":
+		return s.run(false)
+	case "next", "stepIn", "stepOut":
+		return s.step()
+	}
+	return nil
+}
+
+func (s *Server) launch(arguments json.RawMessage) error {
+	var args struct {
+		Program     string `json:"program"`
+		StopOnEntry bool   `json:"stopOnEntry"`
+		MaxCycles   int    `json:"maxCycles"`
+		// IncludePath is the directories searched for included files
+		IncludePath []string `json:"includePath"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return err
+	}
+	if args.Program == "" {
+		return errors.New("launch needs program")
+	}
+
+	file, err := os.Open(args.Program)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	d, err := debugger.New(file, args.Program, args.IncludePath...)
+	if err != nil {
+		return err
+	}
+
+	s.debugger, s.program, s.stopOnEntry = d, args.Program, args.StopOnEntry
+	s.maxCycles = args.MaxCycles
+	if s.maxCycles == 0 {
+		s.maxCycles = defaultMaxCycles
+	}
+	return nil
+}
+
+func (s *Server) setBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		Source      source `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	s.breakpoints = map[uint16]bool{}
+	breakpoints := make([]breakpoint, len(args.Breakpoints))
+	for i, requested := range args.Breakpoints {
+		breakpoints[i] = breakpoint{Line: requested.Line, Source: args.Source}
+		if s.debugger == nil || !samePath(args.Source.Path, s.program) {
+			breakpoints[i].Message = "source is not the launched program"
+			continue
+		}
+		addr, ok := s.debugger.Address(requested.Line)
+		if !ok {
+			breakpoints[i].Message = "no instruction at or after the line"
+			continue
+		}
+		pos, _ := s.debugger.Position(addr)
+		s.breakpoints[addr] = true
+		breakpoints[i].Verified, breakpoints[i].Line = true, pos.Line
+	}
+	return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+func (s *Server) stackFrames() []stackFrame {
+	cpu := s.debugger.CPU
+	frame := stackFrame{ID: 1, Name: "main", Source: source{Name: filepath.Base(s.program), Path: s.program}}
+	if label, ok := s.debugger.LabelAt(cpu.PC); ok {
+		frame.Name = label
+	}
+	if pos, ok := s.debugger.Position(cpu.PC); ok {
+		frame.Line, frame.Column = pos.Line, pos.Column
+	}
+	return []stackFrame{frame}
+}
+
+func (s *Server) variables(reference int) []variable {
+	cpu := s.debugger.CPU
+	switch reference {
+	case registersReference:
+		variables := []variable{
+			{Name: "A", Value: strconv.Itoa(int(int16(cpu.A)))},
+			{Name: "D", Value: strconv.Itoa(int(int16(cpu.D)))},
+			{Name: "PC", Value: strconv.Itoa(int(cpu.PC))},
+		}
+		if int(cpu.A) < emulator.RAMSize {
+			variables = append(variables, variable{Name: "M", Value: strconv.Itoa(int(int16(cpu.RAM[cpu.A])))})
+		}
+		return variables
+	case variablesReference:
+		variables := []variable{}
+		for _, v := range s.debugger.Variables() {
+			variables = append(variables, variable{Name: v.Name, Value: strconv.Itoa(int(int16(cpu.RAM[v.Addr])))})
+		}
+		return variables
+	}
+	return []variable{}
+}
+
+// run runs the program until a breakpoint, the end of the program or maxCycles.
+// A breakpoint at the current instruction stops the program when it starts, but not
+// when it continues from the breakpoint.
+func (s *Server) run(start bool) error {
+	cpu := s.debugger.CPU
+	if start && s.breakpoints[cpu.PC] {
+		return s.sendStopped("breakpoint", "")
+	}
+	for cycles := 0; cycles < s.maxCycles; cycles++ {
+		if cpu.Halted() {
+			return s.terminate()
+		}
+		if err := cpu.Step(); err != nil {
+			return s.sendStopped("exception", err.Error())
+		}
+		if s.breakpoints[cpu.PC] {
+			return s.sendStopped("breakpoint", "")
+		}
+	}
+	return s.sendStopped("pause", fmt.Sprintf("stopped after %d cycles", s.maxCycles))
+}
+
+// step executes an instruction.
+func (s *Server) step() error {
+	cpu := s.debugger.CPU
+	if cpu.Halted() {
+		return s.terminate()
+	}
+	if err := cpu.Step(); err != nil {
+		return s.sendStopped("exception", err.Error())
+	}
+	return s.sendStopped("step", "")
+}
+
+// samePath reports whether paths are the same file. Editors send absolute paths,
+// while the program can be relative to the working directory.
+func samePath(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
+}
+
+func (s *Server) terminate() error {
+	if s.terminated {
+		return nil
+	}
+	s.terminated = true
+	if err := s.sendEvent("exited", map[string]interface{}{"exitCode": 0}); err != nil {
+		return err
+	}
+	return s.sendEvent("terminated", nil)
+}
+
+func (s *Server) sendStopped(reason string, text string) error {
+	body := map[string]interface{}{"reason": reason, "threadId": threadID, "allThreadsStopped": true}
+	if text != "" {
+		body["text"] = text
+	}
+	return s.sendEvent("stopped", body)
+}
+
+func (s *Server) respond(request Message, body interface{}) error {
+	success := true
+	return s.send(Message{Type: "response", Command: request.Command, RequestSeq: request.Seq, Success: &success}, body)
+}
+
+func (s *Server) respondError(request Message, err error) error {
+	success := false
+	return s.send(Message{Type: "response", Command: request.Command, RequestSeq: request.Seq, Success: &success,
+		Message: err.Error()}, nil)
+}
+
+func (s *Server) sendEvent(event string, body interface{}) error {
+	return s.send(Message{Type: "event", Event: event}, body)
+}
+
+func (s *Server) send(message Message, body interface{}) error {
+	s.seq += 1
+	message.Seq = s.seq
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		message.Body = data
+	}
+	content, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return wire.Write(s.writer, content)
+}
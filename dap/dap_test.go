@@ -0,0 +1,323 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fidemin/hack-assembler/internal/wire"
+)
+
+const program = `// counts RAM[0] down to 0
+	@5
+	D=A
+	@count
+	M=D
+(LOOP)
+	@count
+	MD=M-1
+	@LOOP
+	D;JGT
+(END)
+	@END
+	0;JMP
+`
+
+// client is a DAP client talking with Server.
+type client struct {
+	t      *testing.T
+	writer io.WriteCloser
+	reader *bufio.Reader
+	seq    int
+	done   chan error
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+	serverReader, clientWriter := io.Pipe()
+	clientReader, serverWriter := io.Pipe()
+	c := &client{t: t, writer: clientWriter, reader: bufio.NewReader(clientReader), done: make(chan error, 1)}
+	go func() {
+		err := NewServer(serverReader, serverWriter).Serve()
+		serverWriter.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+// request sends a request and returns its response, skipping events.
+func (c *client) request(command string, arguments interface{}) Message {
+	c.t.Helper()
+	c.send(command, arguments)
+	for {
+		message := c.receive()
+		if message.Type == "response" {
+			if message.Command != command || message.RequestSeq != c.seq {
+				c.t.Fatalf("response %s %d, want %s %d", message.Command, message.RequestSeq, command, c.seq)
+			}
+			return message
+		}
+	}
+}
+
+func (c *client) send(command string, arguments interface{}) {
+	c.t.Helper()
+	c.seq += 1
+	args, err := json.Marshal(arguments)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	content, err := json.Marshal(Message{Seq: c.seq, Type: "request", Command: command, Arguments: args})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := wire.Write(c.writer, content); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) receive() Message {
+	c.t.Helper()
+	content, err := wire.Read(c.reader)
+	if err != nil {
+		c.t.Fatalf("reading message: %s", err)
+	}
+	var message Message
+	if err := json.Unmarshal(content, &message); err != nil {
+		c.t.Fatal(err)
+	}
+	return message
+}
+
+// event receives the next message, which should be event.
+func (c *client) event(event string) map[string]interface{} {
+	c.t.Helper()
+	message := c.receive()
+	if message.Type != "event" || message.Event != event {
+		c.t.Fatalf("received %s %s%s, want event %s", message.Type, message.Command, message.Event, event)
+	}
+	var body map[string]interface{}
+	if message.Body != nil {
+		if err := json.Unmarshal(message.Body, &body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	return body
+}
+
+func (c *client) succeed(message Message) map[string]interface{} {
+	c.t.Helper()
+	if message.Success == nil || !*message.Success {
+		c.t.Fatalf("%s failed: %s", message.Command, message.Message)
+	}
+	var body map[string]interface{}
+	if message.Body != nil {
+		if err := json.Unmarshal(message.Body, &body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	return body
+}
+
+// variables returns variables of reference as map from name to value.
+func (c *client) variables(reference int) map[string]string {
+	c.t.Helper()
+	body := c.succeed(c.request("variables", map[string]interface{}{"variablesReference": reference}))
+	variables := map[string]string{}
+	for _, v := range body["variables"].([]interface{}) {
+		v := v.(map[string]interface{})
+		variables[v["name"].(string)] = v["value"].(string)
+	}
+	return variables
+}
+
+func (c *client) close() {
+	c.t.Helper()
+	c.succeed(c.request("disconnect", nil))
+	if err := <-c.done; err != nil {
+		c.t.Errorf("Serve() results in error: %s", err)
+	}
+}
+
+func writeProgram(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "Count.asm")
+	if err := ioutil.WriteFile(path, []byte(program), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestServer_breakpoints(t *testing.T) {
+	path := writeProgram(t)
+	c := newClient(t)
+
+	c.succeed(c.request("initialize", map[string]interface{}{"adapterID": "hack"}))
+	c.succeed(c.request("launch", map[string]interface{}{"program": path}))
+	c.event("initialized")
+
+	// line 6 is (LOOP), and line 100 has no instruction
+	body := c.succeed(c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": path},
+		"breakpoints": []map[string]interface{}{{"line": 6}, {"line": 100}},
+	}))
+	breakpoints := body["breakpoints"].([]interface{})
+	if got := breakpoints[0].(map[string]interface{}); got["verified"] != true || got["line"] != 7.0 {
+		t.Errorf("breakpoint at line 6 = %v, want verified at line 7", got)
+	}
+	if got := breakpoints[1].(map[string]interface{}); got["verified"] != false {
+		t.Errorf("breakpoint at line 100 = %v, want not verified", got)
+	}
+
+	c.succeed(c.request("configurationDone", nil))
+	if body := c.event("stopped"); body["reason"] != "breakpoint" {
+		t.Errorf("stopped reason = %v, want breakpoint", body["reason"])
+	}
+
+	body = c.succeed(c.request("stackTrace", map[string]interface{}{"threadId": threadID}))
+	frame := body["stackFrames"].([]interface{})[0].(map[string]interface{})
+	if frame["name"] != "LOOP" || frame["line"] != 7.0 || frame["source"].(map[string]interface{})["path"] != path {
+		t.Errorf("stack frame = %v, want LOOP at line 7", frame)
+	}
+
+	registers := c.variables(registersReference)
+	if registers["PC"] != "4" || registers["D"] != "5" {
+		t.Errorf("registers = %v, want PC 4 and D 5", registers)
+	}
+	if variables := c.variables(variablesReference); variables["count"] != "5" || len(variables) != 1 {
+		t.Errorf("variables = %v, want count 5", variables)
+	}
+
+	c.succeed(c.request("continue", map[string]interface{}{"threadId": threadID}))
+	c.event("stopped")
+	if variables := c.variables(variablesReference); variables["count"] != "4" {
+		t.Errorf("variables = %v, want count 4", variables)
+	}
+
+	// clear breakpoints and run to the end
+	c.succeed(c.request("setBreakpoints", map[string]interface{}{"source": map[string]interface{}{"path": path}}))
+	c.succeed(c.request("continue", map[string]interface{}{"threadId": threadID}))
+	if body := c.event("exited"); body["exitCode"] != 0.0 {
+		t.Errorf("exit code = %v, want 0", body["exitCode"])
+	}
+	c.event("terminated")
+	c.close()
+}
+
+func TestServer_breakpoints_entry(t *testing.T) {
+	path := writeProgram(t)
+	c := newClient(t)
+
+	c.succeed(c.request("initialize", nil))
+	c.succeed(c.request("launch", map[string]interface{}{"program": path}))
+	c.event("initialized")
+	// line 2 is the first instruction at ROM 0
+	c.succeed(c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": path},
+		"breakpoints": []map[string]interface{}{{"line": 2}},
+	}))
+	c.succeed(c.request("configurationDone", nil))
+	if body := c.event("stopped"); body["reason"] != "breakpoint" {
+		t.Errorf("stopped reason = %v, want breakpoint", body["reason"])
+	}
+	if registers := c.variables(registersReference); registers["PC"] != "0" {
+		t.Errorf("registers = %v, want PC 0", registers)
+	}
+
+	// continue leaves the breakpoint
+	c.succeed(c.request("continue", map[string]interface{}{"threadId": threadID}))
+	c.event("exited")
+	c.event("terminated")
+	c.close()
+}
+
+func TestServer_breakpoints_relativeProgram(t *testing.T) {
+	path := writeProgram(t)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	relative, err := filepath.Rel(wd, path)
+	if err != nil {
+		t.Skip("program is not reachable from the working directory")
+	}
+	c := newClient(t)
+
+	c.succeed(c.request("initialize", nil))
+	c.succeed(c.request("launch", map[string]interface{}{"program": relative}))
+	c.event("initialized")
+	body := c.succeed(c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": path},
+		"breakpoints": []map[string]interface{}{{"line": 6}},
+	}))
+	if got := body["breakpoints"].([]interface{})[0].(map[string]interface{}); got["verified"] != true {
+		t.Errorf("breakpoint = %v, want verified", got)
+	}
+	c.close()
+}
+
+func TestServer_step(t *testing.T) {
+	path := writeProgram(t)
+	c := newClient(t)
+
+	c.succeed(c.request("initialize", nil))
+	c.succeed(c.request("launch", map[string]interface{}{"program": path, "stopOnEntry": true}))
+	c.event("initialized")
+	c.succeed(c.request("configurationDone", nil))
+	if body := c.event("stopped"); body["reason"] != "entry" {
+		t.Errorf("stopped reason = %v, want entry", body["reason"])
+	}
+
+	c.succeed(c.request("next", map[string]interface{}{"threadId": threadID}))
+	if body := c.event("stopped"); body["reason"] != "step" {
+		t.Errorf("stopped reason = %v, want step", body["reason"])
+	}
+	if registers := c.variables(registersReference); registers["A"] != "5" || registers["PC"] != "1" {
+		t.Errorf("registers = %v, want A 5 and PC 1", registers)
+	}
+	c.close()
+}
+
+func TestServer_error(t *testing.T) {
+	c := newClient(t)
+	c.succeed(c.request("initialize", nil))
+
+	for _, test := range []struct {
+		command   string
+		arguments interface{}
+	}{
+		{command: "launch", arguments: map[string]interface{}{"program": filepath.Join(t.TempDir(), "None.asm")}},
+		{command: "launch", arguments: map[string]interface{}{}},
+		{command: "configurationDone", arguments: nil},
+		{command: "continue", arguments: map[string]interface{}{"threadId": threadID}},
+		{command: "next", arguments: map[string]interface{}{"threadId": threadID}},
+		{command: "stackTrace", arguments: map[string]interface{}{"threadId": threadID}},
+		{command: "evaluate", arguments: map[string]interface{}{"expression": "D"}},
+	} {
+		response := c.request(test.command, test.arguments)
+		if response.Success == nil || *response.Success || response.Message == "" {
+			t.Errorf("%s response = %+v, want failure with message", test.command, response)
+		}
+	}
+	c.close()
+}
+
+func TestServer_maxCycles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Loop.asm")
+	if err := ioutil.WriteFile(path, []byte("(LOOP)\n@LOOP\nD;JEQ\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(t)
+	c.succeed(c.request("initialize", nil))
+	c.succeed(c.request("launch", map[string]interface{}{"program": path, "maxCycles": 100}))
+	c.event("initialized")
+	c.succeed(c.request("configurationDone", nil))
+	if body := c.event("stopped"); body["reason"] != "pause" {
+		t.Errorf("stopped reason = %v, want pause", body["reason"])
+	}
+	c.close()
+}
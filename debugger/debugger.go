@@ -0,0 +1,507 @@
+// Package debugger runs hack assembly programs step by step with breakpoints and watchpoints.
+package debugger
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fidemin/hack-assembler/assembler"
+	"github.com/fidemin/hack-assembler/emulator"
+)
+
+// Prompt is shown before each command of Run.
+const Prompt = "(hackdb) "
+
+// Debugger debugs a hack assembly program with emulator.
+type Debugger struct {
+	// MaxCycles stops continue after that many cycles. 0 means no limit.
+	MaxCycles int
+	CPU       *emulator.CPU
+	parser    *assembler.Parser
+	// lines are the source lines without line endings
+	lines []string
+	// commands has A and C commands by ROM address
+	commands []assembler.Command
+	// breakpoints are ROM addresses
+	breakpoints map[uint16]bool
+	// watchpoints map RAM addresses to their last values
+	watchpoints map[uint16]uint16
+}
+
+// New assembles the program read from reader and returns *Debugger with the program loaded.
+// filename is used for positions, and files of .include are searched relative to it
+// and then in includePath.
+func New(reader io.Reader, filename string, includePath ...string) (*Debugger, error) {
+	source, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	code := new(bytes.Buffer)
+	asm := assembler.New(bytes.NewReader(source), code)
+	asm.Filename = filepath.ToSlash(filename)
+	asm.FS = assembler.OSFS
+	asm.IncludePath = includePath
+	asm.Format = assembler.BinaryFormat
+	if err := asm.WriteBinaryCode(); err != nil {
+		return nil, err
+	}
+	words, err := assembler.BinaryFormat.(assembler.FormatReader).Read(code)
+	if err != nil {
+		return nil, err
+	}
+	cpu, err := emulator.New(words)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Debugger{
+		CPU:         cpu,
+		parser:      asm.Parser,
+		lines:       strings.Split(strings.ReplaceAll(string(source), "\r\n", "\n"), "\n"),
+		breakpoints: map[uint16]bool{},
+		watchpoints: map[uint16]uint16{},
+	}
+	for _, command := range asm.Parser.Commands {
+		if command.CommandType == assembler.ACommand || command.CommandType == assembler.CCommand {
+			d.commands = append(d.commands, command)
+		}
+	}
+	return d, nil
+}
+
+// Run reads commands from input line by line and writes results to output until quit or the end of input.
+func (d *Debugger) Run(input io.Reader, output io.Writer) error {
+	scanner := bufio.NewScanner(input)
+	d.where(output)
+	for {
+		fmt.Fprint(output, Prompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(output)
+			return scanner.Err()
+		}
+		quit, err := d.Execute(scanner.Text(), output)
+		if err != nil {
+			fmt.Fprintf(output, "error: %s\n", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// Execute executes a debugger command and writes its result to output. It returns true for quit.
+func (d *Debugger) Execute(line string, output io.Writer) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, nil
+	}
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case "quit", "q":
+		return true, nil
+	case "help", "h":
+		fmt.Fprint(output, help)
+	case "step", "s":
+		count := 1
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return false, errors.New(fmt.Sprintf("invalid step count %q", args[0]))
+			}
+			count = n
+		}
+		for i := 0; i < count; i++ {
+			if stop, err := d.step(output); err != nil || stop {
+				d.where(output)
+				return false, err
+			}
+		}
+		d.where(output)
+	case "continue", "c":
+		for cycles := 0; ; cycles++ {
+			if d.MaxCycles > 0 && cycles >= d.MaxCycles {
+				fmt.Fprintf(output, "stopped after %d cycles\n", cycles)
+				break
+			}
+			stop, err := d.step(output)
+			if err != nil {
+				d.where(output)
+				return false, err
+			}
+			if stop {
+				break
+			}
+			if d.breakpoints[d.CPU.PC] {
+				fmt.Fprintf(output, "breakpoint at %d\n", d.CPU.PC)
+				break
+			}
+		}
+		d.where(output)
+	case "break", "b", "delete", "d":
+		if len(args) != 1 {
+			return false, errors.New(fmt.Sprintf("%s needs a label or a line number", name))
+		}
+		addr, err := d.location(args[0])
+		if err != nil {
+			return false, err
+		}
+		if name == "break" || name == "b" {
+			d.breakpoints[addr] = true
+			fmt.Fprintf(output, "breakpoint at %d: %s\n", addr, d.source(addr))
+		} else {
+			delete(d.breakpoints, addr)
+		}
+	case "watch", "w", "unwatch":
+		if len(args) != 1 {
+			return false, errors.New(fmt.Sprintf("%s needs a RAM address", name))
+		}
+		addr, err := d.ramAddress(args[0])
+		if err != nil {
+			return false, err
+		}
+		if name == "unwatch" {
+			delete(d.watchpoints, addr)
+		} else {
+			d.watchpoints[addr] = d.CPU.RAM[addr]
+		}
+	case "info", "i":
+		d.info(output)
+	case "print", "p":
+		if len(args) == 0 {
+			return false, errors.New("print needs an expression")
+		}
+		for _, arg := range args {
+			value, err := d.value(arg)
+			if err != nil {
+				return false, err
+			}
+			fmt.Fprintf(output, "%s = %d\n", arg, int16(value))
+		}
+	case "set":
+		if len(args) != 2 {
+			return false, errors.New("set needs a register or RAM address, and a value")
+		}
+		value, err := parseNumber(args[1])
+		if err != nil {
+			return false, err
+		}
+		return false, d.set(args[0], value)
+	case "list", "l":
+		d.list(output)
+	case "where":
+		d.where(output)
+	case "reset":
+		d.CPU.Reset()
+		d.where(output)
+	default:
+		return false, errors.New(fmt.Sprintf("unknown command %q, try help", name))
+	}
+	return false, nil
+}
+
+const help = `commands:
+  step [n], s        execute n instructions
+  continue, c        run until a breakpoint, a watchpoint or the end of the program
+  break LABEL|LINE   stop before the instruction of label or source line
+  delete LABEL|LINE  delete breakpoint
+  watch ADDR         stop when RAM[ADDR] changes, e.g. watch i, watch RAM[LCL]
+  unwatch ADDR       delete watchpoint
+  info               show breakpoints and watchpoints
+  print EXPR, p      print A, D, PC, RAM[n], RAM[symbol] or a symbol, e.g. print i
+  set NAME VALUE     set A, D, PC, RAM[n], a variable or RAM of R0-R15, SP, LCL, ...
+  list, l            show source around the current line
+  reset              set PC to 0
+  quit, q            quit
+`
+
+// step executes an instruction and returns true when the program should stop by halt or watchpoint.
+func (d *Debugger) step(output io.Writer) (bool, error) {
+	if d.CPU.Halted() {
+		fmt.Fprintln(output, "program halted")
+		return true, nil
+	}
+	if err := d.CPU.Step(); err != nil {
+		return true, err
+	}
+
+	changed := false
+	for _, addr := range sortedKeys(d.watchpoints) {
+		old, value := d.watchpoints[addr], d.CPU.RAM[addr]
+		if old != value {
+			fmt.Fprintf(output, "watchpoint RAM[%d]%s: %d -> %d\n", addr, d.symbolSuffix(addr), int16(old), int16(value))
+			d.watchpoints[addr] = value
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// symbolSuffix returns " (name)" for a variable at RAM address, or "".
+func (d *Debugger) symbolSuffix(addr uint16) string {
+	var names []string
+	for _, command := range d.commands {
+		symbol := command.Symbol
+		if command.CommandType != assembler.ACommand || isNumber(symbol) || d.parser.IsLabel(symbol) || d.parser.IsConstant(symbol) {
+			continue
+		}
+		if value, ok := d.parser.LookupSymbol(symbol); ok && value == addr && !contains(names, symbol) {
+			names = append(names, symbol)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(names, ", ") + ")"
+}
+
+// Variable is a variable of the program allocated in RAM by the assembler.
+type Variable struct {
+	Name string
+	Addr uint16
+}
+
+// Variables returns variables of the program in order of RAM address.
+func (d *Debugger) Variables() []Variable {
+	var variables []Variable
+	for _, symbol := range d.parser.Symbols() {
+		if symbol.Kind == assembler.VariableSymbol {
+			variables = append(variables, Variable{Name: symbol.Name, Addr: symbol.Address})
+		}
+	}
+	return variables
+}
+
+// Position returns the source position of the instruction at ROM address in the program file.
+// Instructions expanded from a macro are at the macro invocation, and instructions of
+// included files are at the .include line.
+func (d *Debugger) Position(addr uint16) (assembler.Position, bool) {
+	if int(addr) >= len(d.commands) {
+		return assembler.Position{}, false
+	}
+	return d.commands[addr].Pos.Main(), true
+}
+
+// Address returns ROM address of the first instruction at or after the source line.
+func (d *Debugger) Address(line int) (uint16, bool) {
+	for addr, command := range d.commands {
+		if command.Pos.Main().Line >= line {
+			return uint16(addr), true
+		}
+	}
+	return 0, false
+}
+
+// LabelAt returns the label of the code at ROM address: the last label declared at or before it.
+func (d *Debugger) LabelAt(addr uint16) (string, bool) {
+	label, found := "", false
+	for _, command := range d.parser.Commands {
+		if command.CommandType != assembler.LCommand {
+			continue
+		}
+		labelAddr, _ := d.parser.LookupSymbol(command.Symbol)
+		if labelAddr <= addr && d.parser.IsLabel(command.Symbol) {
+			label, found = command.Symbol, true
+		}
+	}
+	return label, found
+}
+
+// location returns ROM address of a label, or of the first instruction at or after a source line.
+func (d *Debugger) location(arg string) (uint16, error) {
+	if line, err := strconv.Atoi(arg); err == nil {
+		addr, ok := d.Address(line)
+		if !ok {
+			return 0, errors.New(fmt.Sprintf("no instruction at or after line %d", line))
+		}
+		return addr, nil
+	}
+	if !d.parser.IsLabel(arg) {
+		return 0, errors.New(fmt.Sprintf("unknown label %q", arg))
+	}
+	addr, _ := d.parser.LookupSymbol(arg)
+	return addr, nil
+}
+
+// ramAddress returns RAM address of RAM[n], RAM[symbol], a symbol or a number.
+func (d *Debugger) ramAddress(arg string) (uint16, error) {
+	if strings.HasPrefix(arg, "RAM[") && strings.HasSuffix(arg, "]") {
+		arg = arg[4 : len(arg)-1]
+	}
+	addr, err := parseNumber(arg)
+	if err != nil {
+		var ok bool
+		if addr, ok = d.parser.LookupSymbol(arg); !ok {
+			return 0, errors.New(fmt.Sprintf("unknown symbol %q", arg))
+		}
+	}
+	if int(addr) >= emulator.RAMSize {
+		return 0, errors.New(fmt.Sprintf("RAM address %d is out of RAM", addr))
+	}
+	return addr, nil
+}
+
+// value returns the value of A, D, PC, RAM[n], RAM[symbol], or a symbol.
+// A variable gives its value in RAM, and other symbols give their addresses.
+func (d *Debugger) value(arg string) (uint16, error) {
+	switch arg {
+	case "A":
+		return d.CPU.A, nil
+	case "D":
+		return d.CPU.D, nil
+	case "PC":
+		return d.CPU.PC, nil
+	}
+	if strings.HasPrefix(arg, "RAM[") || d.isVariable(arg) {
+		addr, err := d.ramAddress(arg)
+		if err != nil {
+			return 0, err
+		}
+		return d.CPU.RAM[addr], nil
+	}
+	if addr, ok := d.parser.LookupSymbol(arg); ok {
+		return addr, nil
+	}
+	return 0, errors.New(fmt.Sprintf("unknown symbol %q", arg))
+}
+
+// set sets A, D, PC, RAM[n], RAM[symbol] or a variable. A predefined symbol like R0 sets
+// RAM at its address.
+func (d *Debugger) set(arg string, value uint16) error {
+	switch arg {
+	case "A":
+		d.CPU.A = value
+	case "D":
+		d.CPU.D = value
+	case "PC":
+		d.CPU.PC = value
+	default:
+		if _, ok := assembler.PredefinedSymbols()[arg]; !ok && !strings.HasPrefix(arg, "RAM[") && !d.isVariable(arg) {
+			return errors.New(fmt.Sprintf("%q is not a register, RAM, predefined symbol or variable", arg))
+		}
+		addr, err := d.ramAddress(arg)
+		if err != nil {
+			return err
+		}
+		d.CPU.RAM[addr] = value
+		if _, ok := d.watchpoints[addr]; ok {
+			d.watchpoints[addr] = value
+		}
+	}
+	return nil
+}
+
+// isVariable reports whether name is a variable allocated by the assembler.
+func (d *Debugger) isVariable(name string) bool {
+	for _, variable := range d.Variables() {
+		if variable.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// where writes the registers and the source line of PC.
+func (d *Debugger) where(output io.Writer) {
+	fmt.Fprintf(output, "PC=%d A=%d D=%d  %s\n", d.CPU.PC, int16(d.CPU.A), int16(d.CPU.D), d.source(d.CPU.PC))
+}
+
+// source returns position and source line of the instruction at ROM address.
+func (d *Debugger) source(addr uint16) string {
+	if int(addr) >= len(d.commands) {
+		return "end of program"
+	}
+	command := d.commands[addr]
+	pos := command.Pos.Source()
+	if pos.IncludedFrom != nil {
+		// only lines of the program file are loaded
+		return fmt.Sprintf("%s: %s", pos, command.Text)
+	}
+	return fmt.Sprintf("%s: %s", pos, strings.TrimSpace(d.lines[pos.Line-1]))
+}
+
+// list writes source lines around the current line. "=>" marks the current line and "*" marks breakpoints.
+func (d *Debugger) list(output io.Writer) {
+	current := len(d.lines)
+	if int(d.CPU.PC) < len(d.commands) {
+		current = d.commands[d.CPU.PC].Pos.Main().Line
+	}
+	breakLines := map[int]bool{}
+	for addr := range d.breakpoints {
+		if int(addr) < len(d.commands) {
+			breakLines[d.commands[addr].Pos.Main().Line] = true
+		}
+	}
+
+	for line := current - 5; line <= current+5; line++ {
+		if line < 1 || line > len(d.lines) {
+			continue
+		}
+		marker := "  "
+		if line == current {
+			marker = "=>"
+		} else if breakLines[line] {
+			marker = " *"
+		}
+		fmt.Fprintf(output, "%s %4d  %s\n", marker, line, d.lines[line-1])
+	}
+}
+
+// info writes breakpoints and watchpoints.
+func (d *Debugger) info(output io.Writer) {
+	if len(d.breakpoints) == 0 && len(d.watchpoints) == 0 {
+		fmt.Fprintln(output, "no breakpoints or watchpoints")
+	}
+	var addrs []int
+	for addr := range d.breakpoints {
+		addrs = append(addrs, int(addr))
+	}
+	sort.Ints(addrs)
+	for _, addr := range addrs {
+		fmt.Fprintf(output, "breakpoint at %d: %s\n", addr, d.source(uint16(addr)))
+	}
+	for _, addr := range sortedKeys(d.watchpoints) {
+		fmt.Fprintf(output, "watchpoint RAM[%d]%s = %d\n", addr, d.symbolSuffix(addr), int16(d.CPU.RAM[addr]))
+	}
+}
+
+// parseNumber parses a decimal number which can be negative.
+func parseNumber(text string) (uint16, error) {
+	value, err := strconv.ParseInt(text, 10, 32)
+	if err != nil || value < -32768 || value > 65535 {
+		return 0, errors.New(fmt.Sprintf("invalid number %q", text))
+	}
+	return uint16(value), nil
+}
+
+func isNumber(text string) bool {
+	_, err := strconv.ParseUint(text, 10, 16)
+	return err == nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[uint16]uint16) []uint16 {
+	keys := make([]uint16, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
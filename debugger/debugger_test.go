@@ -0,0 +1,261 @@
+package debugger
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sumProgram = `// sums 1..R0 to R1
+	@i
+	M=1
+	@sum
+	M=0
+(LOOP)
+	@i
+	D=M
+	@R0
+	D=D-M
+	@STOP
+	D;JGT
+	@i
+	D=M
+	@sum
+	M=D+M
+	@i
+	M=M+1
+	@LOOP
+	0;JMP
+(STOP)
+	@sum
+	D=M
+	@R1
+	M=D
+(END)
+	@END
+	0;JMP
+`
+
+func newDebugger(t *testing.T) *Debugger {
+	t.Helper()
+	d, err := New(strings.NewReader(sumProgram), "Sum.asm")
+	if err != nil {
+		t.Fatalf("New() results in error: %s", err)
+	}
+	return d
+}
+
+// execute executes commands and returns the output of the last command.
+func execute(t *testing.T, d *Debugger, commands ...string) string {
+	t.Helper()
+	output := new(bytes.Buffer)
+	for _, command := range commands {
+		output.Reset()
+		if _, err := d.Execute(command, output); err != nil {
+			t.Fatalf("d.Execute(%q) results in error: %s", command, err)
+		}
+	}
+	return output.String()
+}
+
+func TestDebugger_Execute_step(t *testing.T) {
+	d := newDebugger(t)
+	if got, wanted := execute(t, d, "step"), "PC=1 A=16 D=0  Sum.asm:3:2: M=1\n"; got != wanted {
+		t.Errorf("step = %q, want %q", got, wanted)
+	}
+	if got, wanted := execute(t, d, "s 3"), "PC=4 A=17 D=0  Sum.asm:7:2: @i\n"; got != wanted {
+		t.Errorf("step 3 = %q, want %q", got, wanted)
+	}
+}
+
+func TestDebugger_Execute_break(t *testing.T) {
+	d := newDebugger(t)
+	d.CPU.RAM[0] = 3
+	if got, wanted := execute(t, d, "break STOP"), "breakpoint at 18: Sum.asm:22:2: @sum\n"; got != wanted {
+		t.Errorf("break = %q, want %q", got, wanted)
+	}
+	got := execute(t, d, "continue")
+	if wanted := "breakpoint at 18\nPC=18 A=18 D=1  Sum.asm:22:2: @sum\n"; got != wanted {
+		t.Errorf("continue = %q, want %q", got, wanted)
+	}
+	if got, wanted := execute(t, d, "print sum i RAM[R0] LOOP"), "sum = 6\ni = 4\nRAM[R0] = 3\nLOOP = 4\n"; got != wanted {
+		t.Errorf("print = %q, want %q", got, wanted)
+	}
+
+	// line 6 is (LOOP), and the breakpoint is at the next instruction
+	execute(t, d, "delete STOP", "break 6", "reset")
+	if got, wanted := execute(t, d, "c"), "breakpoint at 4\nPC=4 A=17 D=1  Sum.asm:7:2: @i\n"; got != wanted {
+		t.Errorf("continue = %q, want %q", got, wanted)
+	}
+}
+
+func TestDebugger_Execute_watch(t *testing.T) {
+	d := newDebugger(t)
+	d.CPU.RAM[0] = 2
+	execute(t, d, "watch sum", "watch RAM[R1]", "step 4")
+
+	got := execute(t, d, "continue")
+	if wanted := "watchpoint RAM[17] (sum): 0 -> 1\nPC=14 A=17 D=1  Sum.asm:17:2: @i\n"; got != wanted {
+		t.Errorf("continue = %q, want %q", got, wanted)
+	}
+	execute(t, d, "unwatch sum")
+	got = execute(t, d, "continue")
+	if wanted := "watchpoint RAM[1] (R1): 0 -> 3\nPC=22 A=1 D=3  Sum.asm:27:2: @END\n"; got != wanted {
+		t.Errorf("continue = %q, want %q", got, wanted)
+	}
+	if got, wanted := execute(t, d, "c"), "program halted\nPC=22 A=1 D=3  Sum.asm:27:2: @END\n"; got != wanted {
+		t.Errorf("continue = %q, want %q", got, wanted)
+	}
+}
+
+func TestDebugger_Execute_error(t *testing.T) {
+	d := newDebugger(t)
+	tests := []string{
+		"jump",
+		"break",
+		"break i",
+		"break 100",
+		"step x",
+		"print j",
+		"watch RAM[40000]",
+		"set LOOP 1",
+	}
+	for _, command := range tests {
+		if _, err := d.Execute(command, new(bytes.Buffer)); err == nil {
+			t.Errorf("d.Execute(%q) should return error", command)
+		}
+	}
+}
+
+func TestDebugger_Run(t *testing.T) {
+	d := newDebugger(t)
+	input := strings.NewReader("set R0 1\nprint RAM[0]\nset i 5\nprint i\nlist\nfoo\nquit\nstep\n")
+	output := new(bytes.Buffer)
+	if err := d.Run(input, output); err != nil {
+		t.Fatalf("d.Run() results in error: %s", err)
+	}
+
+	got := output.String()
+	for _, wanted := range []string{
+		"PC=0 A=0 D=0  Sum.asm:2:2: @i\n(hackdb) ",
+		"RAM[0] = 1\n",
+		"i = 5\n",
+		"=>    2  \t@i\n",
+		"error: unknown command \"foo\", try help\n",
+	} {
+		if !strings.Contains(got, wanted) {
+			t.Errorf("d.Run() output should contain %q:\n%s", wanted, got)
+		}
+	}
+	if count := strings.Count(got, "error:"); count != 1 {
+		t.Errorf("d.Run() output should have only the error of foo:\n%s", got)
+	}
+	if strings.Contains(got, "PC=1") {
+		t.Errorf("d.Run() should quit before step:\n%s", got)
+	}
+}
+
+func TestNew_error(t *testing.T) {
+	if _, err := New(strings.NewReader("@i\nD=X\n"), "Foo.asm"); err == nil {
+		t.Errorf("New() should return error for invalid program")
+	}
+}
+
+func TestDebugger_Position_macro(t *testing.T) {
+	d, err := New(strings.NewReader(".macro INC var\n@var\nM=M+1\n.endm\nINC i\nINC i\n"), "Inc.asm")
+	if err != nil {
+		t.Fatalf("New() results in error: %s", err)
+	}
+	// instructions expanded from a macro are at the invocation
+	if pos, ok := d.Position(3); !ok || pos.Line != 6 || pos.Expansion != nil {
+		t.Errorf("d.Position(3) = %s, %t, want line 6", pos, ok)
+	}
+	if addr, ok := d.Address(6); !ok || addr != 2 {
+		t.Errorf("d.Address(6) = %d, %t, want 2", addr, ok)
+	}
+	if got, wanted := execute(t, d, "step"), "PC=1 A=16 D=0  Inc.asm:5:1: INC i\n"; got != wanted {
+		t.Errorf("step = %q, want %q", got, wanted)
+	}
+}
+
+func TestNew_include(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib")
+	if err := os.Mkdir(lib, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(dir, "inc.asm"): "@i\nM=M+1\n",
+		filepath.Join(lib, "end.asm"): "(END)\n@END\n0;JMP\n",
+	}
+	for file, data := range files {
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	program := filepath.Join(dir, "Main.asm")
+	d, err := New(strings.NewReader("@1\n.include \"inc.asm\"\n.include \"end.asm\"\n"), program, lib)
+	if err != nil {
+		t.Fatalf("New() results in error: %s", err)
+	}
+	// instructions of included files are at the .include line
+	if pos, ok := d.Position(2); !ok || pos.Line != 2 || pos.IncludedFrom != nil {
+		t.Errorf("d.Position(2) = %s, %t, want line 2", pos, ok)
+	}
+	if addr, ok := d.Address(3); !ok || addr != 3 {
+		t.Errorf("d.Address(3) = %d, %t, want 3", addr, ok)
+	}
+	wanted := fmt.Sprintf("PC=1 A=1 D=0  %s:1:1: @i\n", filepath.ToSlash(filepath.Join(dir, "inc.asm")))
+	if got := execute(t, d, "step"); got != wanted {
+		t.Errorf("step = %q, want %q", got, wanted)
+	}
+	if got := execute(t, d, "list"); !strings.Contains(got, "=>    2  .include \"inc.asm\"") {
+		t.Errorf("list = %q, should mark line 2", got)
+	}
+}
+
+func TestDebugger_Variables(t *testing.T) {
+	d := newDebugger(t)
+	wanted := []Variable{{Name: "i", Addr: 16}, {Name: "sum", Addr: 17}}
+	if got := d.Variables(); !reflect.DeepEqual(got, wanted) {
+		t.Errorf("d.Variables() = %+v, want %+v", got, wanted)
+	}
+}
+
+func TestDebugger_Position(t *testing.T) {
+	d := newDebugger(t)
+	if pos, ok := d.Position(4); !ok || pos.Line != 7 {
+		t.Errorf("d.Position(4) = %s, %t, want line 7", pos, ok)
+	}
+	if _, ok := d.Position(100); ok {
+		t.Errorf("d.Position(100) should not be found")
+	}
+	if addr, ok := d.Address(6); !ok || addr != 4 {
+		t.Errorf("d.Address(6) = %d, %t, want 4", addr, ok)
+	}
+	if _, ok := d.Address(30); ok {
+		t.Errorf("d.Address(30) should not be found")
+	}
+
+	tests := []struct {
+		addr   uint16
+		wanted string
+		ok     bool
+	}{
+		{addr: 0, ok: false},
+		{addr: 4, wanted: "LOOP", ok: true},
+		{addr: 17, wanted: "LOOP", ok: true},
+		{addr: 18, wanted: "STOP", ok: true},
+	}
+	for _, test := range tests {
+		if got, ok := d.LabelAt(test.addr); got != test.wanted || ok != test.ok {
+			t.Errorf("d.LabelAt(%d) = %s, %t, want %s, %t", test.addr, got, ok, test.wanted, test.ok)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package disassembler translates Hack machine code back into Hack assembly.
+package disassembler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/fidemin/hack-assembler/assembler"
+)
+
+// Disassembler writes hack assembly of machine code words, a command per line.
+type Disassembler struct {
+	// Labels replaces addresses of jump targets with labels named by the address, e.g. "@L4" and "(L4)"
+	Labels bool
+	// Invalid has ROM addresses of words which are not hack commands, after WriteAssembly.
+	// They are written as comments, so addresses after them differ when the assembly is assembled again.
+	Invalid []int
+	words   []uint16
+	writer  io.Writer
+}
+
+// New returns *Disassembler writing assembly of words to writer. The first word is at ROM address 0.
+func New(words []uint16, writer io.Writer) *Disassembler {
+	return &Disassembler{words: words, writer: writer}
+}
+
+// WriteAssembly writes assembly of all words.
+func (d *Disassembler) WriteAssembly() error {
+	d.Invalid = nil
+	commands := make([]assembler.Command, len(d.words))
+	errs := make([]error, len(d.words))
+	for i, word := range d.words {
+		commands[i], errs[i] = assembler.DecodeCommand(word)
+	}
+
+	var targets map[int]bool
+	if d.Labels {
+		targets = jumpTargets(commands, errs)
+	}
+
+	buffered := bufio.NewWriter(d.writer)
+	for i, command := range commands {
+		if targets[i] {
+			fmt.Fprintf(buffered, "(%s)\n", label(i))
+		}
+		if errs[i] != nil {
+			d.Invalid = append(d.Invalid, i)
+			fmt.Fprintf(buffered, "// invalid: %s\n", errs[i])
+			continue
+		}
+		if targets[int(command.SymbolInt)] && isJump(commands, errs, i) {
+			command.Symbol = label(int(command.SymbolInt))
+		}
+		fmt.Fprintf(buffered, "%s\n", command)
+	}
+	// a jump can target the address just after the program
+	if targets[len(commands)] {
+		fmt.Fprintf(buffered, "(%s)\n", label(len(commands)))
+	}
+	return buffered.Flush()
+}
+
+// jumpTargets returns addresses loaded by A commands followed by jumps.
+// Addresses beyond the end of the program are not jump targets.
+func jumpTargets(commands []assembler.Command, errs []error) map[int]bool {
+	targets := make(map[int]bool)
+	for i := range commands {
+		if isJump(commands, errs, i) && int(commands[i].SymbolInt) <= len(commands) {
+			targets[int(commands[i].SymbolInt)] = true
+		}
+	}
+	return targets
+}
+
+// isJump reports whether commands[i] is A command followed by C command with jump.
+func isJump(commands []assembler.Command, errs []error, i int) bool {
+	if i+1 >= len(commands) || errs[i] != nil || errs[i+1] != nil {
+		return false
+	}
+	return commands[i].CommandType == assembler.ACommand &&
+		commands[i+1].CommandType == assembler.CCommand && commands[i+1].Jump != ""
+}
+
+func label(addr int) string {
+	return "L" + strconv.Itoa(addr)
+}
@@ -0,0 +1,125 @@
+package disassembler
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fidemin/hack-assembler/assembler"
+)
+
+func TestDisassembler_WriteAssembly(t *testing.T) {
+	// @2 D=A @3 D=D+A @0 M=D
+	words := []uint16{0x0002, 0xec10, 0x0003, 0xe090, 0x0000, 0xe308}
+	writer := new(bytes.Buffer)
+	if err := New(words, writer).WriteAssembly(); err != nil {
+		t.Fatalf("disassembler.WriteAssembly() results in error: %s", err)
+	}
+
+	wanted := "@2\nD=A\n@3\nD=D+A\n@0\nM=D\n"
+	if got := writer.String(); got != wanted {
+		t.Errorf("disassembler.WriteAssembly() = %q, want %q", got, wanted)
+	}
+}
+
+func TestDisassembler_WriteAssembly_labels(t *testing.T) {
+	words := []uint16{
+		0x0004, // @4 is a jump target
+		0xe302, // D;JEQ
+		0x0004, // @4 is data
+		0xe308, // M=D
+		0x0007, // @7 is the last command
+		0xea87, // 0;JMP
+		0x7fff, // @32767 is out of the program
+		0xea87, // 0;JMP
+	}
+	writer := new(bytes.Buffer)
+	disassembler := New(words, writer)
+	disassembler.Labels = true
+	if err := disassembler.WriteAssembly(); err != nil {
+		t.Fatalf("disassembler.WriteAssembly() results in error: %s", err)
+	}
+
+	wanted := `@L4
+D;JEQ
+@4
+M=D
+(L4)
+@L7
+0;JMP
+@32767
+(L7)
+0;JMP
+`
+	if got := writer.String(); got != wanted {
+		t.Errorf("disassembler.WriteAssembly() =\n%s\nwant\n%s", got, wanted)
+	}
+
+	words = []uint16{0x0002, 0xea87}
+	writer.Reset()
+	disassembler = New(words, writer)
+	disassembler.Labels = true
+	if err := disassembler.WriteAssembly(); err != nil {
+		t.Fatalf("disassembler.WriteAssembly() results in error: %s", err)
+	}
+	wanted = "@L2\n0;JMP\n(L2)\n"
+	if got := writer.String(); got != wanted {
+		t.Errorf("disassembler.WriteAssembly() = %q, want %q", got, wanted)
+	}
+}
+
+func TestDisassembler_WriteAssembly_invalid(t *testing.T) {
+	// comp bits 0000001 is not a comp operation
+	words := []uint16{0x0002, 0xe040, 0xea87}
+	writer := new(bytes.Buffer)
+	disassembler := New(words, writer)
+	if err := disassembler.WriteAssembly(); err != nil {
+		t.Fatalf("disassembler.WriteAssembly() results in error: %s", err)
+	}
+
+	if !reflect.DeepEqual(disassembler.Invalid, []int{1}) {
+		t.Errorf("disassembler.Invalid = %v, want [1]", disassembler.Invalid)
+	}
+	lines := strings.Split(writer.String(), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[1], "// invalid: 1110000001000000") {
+		t.Errorf("disassembler.WriteAssembly() = %q, should flag the second word", writer.String())
+	}
+}
+
+// TestDisassembler_WriteAssembly_programs disassembles .hack files in testdata
+// and checks the assembly is assembled to the same machine code.
+func TestDisassembler_WriteAssembly_programs(t *testing.T) {
+	for _, name := range []string{"Add", "Max", "Rect"} {
+		for _, labels := range []bool{false, true} {
+			file, err := os.Open(filepath.Join("..", "assembler", "testdata", name+".hack"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			words, err := assembler.HackFormat.(assembler.FormatReader).Read(file)
+			file.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assembly := new(bytes.Buffer)
+			disassembler := New(words, assembly)
+			disassembler.Labels = labels
+			if err := disassembler.WriteAssembly(); err != nil {
+				t.Fatalf("%s.hack: disassembler.WriteAssembly() results in error: %s", name, err)
+			}
+
+			code := new(bytes.Buffer)
+			if err := assembler.New(bytes.NewReader(assembly.Bytes()), code).WriteBinaryCode(); err != nil {
+				t.Fatalf("%s.hack: assembly cannot be assembled: %s\n%s", name, err, assembly)
+			}
+			wanted, _ := ioutil.ReadFile(filepath.Join("..", "assembler", "testdata", name+".hack"))
+			if code.String() != string(wanted) {
+				t.Errorf("%s.hack: assembly is assembled to different code\nassembly:\n%s", name, assembly)
+			}
+		}
+	}
+}
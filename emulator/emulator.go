@@ -0,0 +1,169 @@
+// Package emulator executes Hack machine code.
+package emulator
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// ROMSize is the number of words in instruction memory
+	ROMSize = 32768
+	// RAMSize is the number of words in data memory
+	RAMSize = 32768
+	// Screen is the RAM address of the screen memory map, SCREEN symbol of hack assembly.
+	// Each row of 512 pixels is 32 words, and the least significant bit is the leftmost pixel.
+	Screen = 16384
+	// ScreenWords is the number of words of the screen memory map
+	ScreenWords = 8192
+	// Keyboard is the RAM address of the keyboard memory map, KBD symbol of hack assembly.
+	// It has the character code of the pressed key, or 0 when no key is pressed.
+	Keyboard = 24576
+)
+
+// CPU is a Hack computer: CPU registers with ROM and RAM.
+// Registers and memories can be set and read directly, e.g. to give input to a program.
+type CPU struct {
+	A   uint16
+	D   uint16
+	PC  uint16
+	ROM [ROMSize]uint16
+	RAM [RAMSize]uint16
+	// Cycles is the number of executed instructions
+	Cycles int
+	// size is the number of words of the loaded program
+	size int
+}
+
+// New returns *CPU with program loaded to ROM from address 0. All registers and RAM are 0.
+func New(program []uint16) (*CPU, error) {
+	if len(program) > ROMSize {
+		return nil, errors.New(fmt.Sprintf("program has %d words, ROM has only %d words", len(program), ROMSize))
+	}
+	cpu := &CPU{size: len(program)}
+	copy(cpu.ROM[:], program)
+	return cpu, nil
+}
+
+// Reset sets PC to 0 like the reset bit of Hack CPU. Other registers and RAM are not changed.
+func (c *CPU) Reset() {
+	c.PC = 0
+}
+
+// Step executes the instruction at PC.
+// It returns error when the instruction accesses M out of RAM. Registers and RAM are not changed then.
+func (c *CPU) Step() error {
+	if int(c.PC) >= ROMSize {
+		return errors.New(fmt.Sprintf("PC %d is out of ROM", c.PC))
+	}
+	instruction := c.ROM[c.PC]
+
+	// A instruction: 0 v v v v v v v v v v v v v v v
+	if instruction>>15 == 0 {
+		c.A = instruction
+		c.PC += 1
+		c.Cycles += 1
+		return nil
+	}
+
+	// C instruction: 1 1 1 a c1 c2 c3 c4 c5 c6 d1 d2 d3 j1 j2 j3
+	usesM := instruction>>12&1 == 1
+	writesA, writesD, writesM := instruction>>5&1 == 1, instruction>>4&1 == 1, instruction>>3&1 == 1
+	if (usesM || writesM) && int(c.A) >= RAMSize {
+		return errors.New(fmt.Sprintf("M at ROM address %d: RAM address %d is out of RAM", c.PC, c.A))
+	}
+
+	y := c.A
+	if usesM {
+		y = c.RAM[c.A]
+	}
+	out := alu(c.D, y, instruction>>6&0b111111)
+
+	if writesM {
+		c.RAM[c.A] = out
+	}
+	// A is updated after M is written, so AM=... writes M at the previous A
+	address := c.A
+	if writesA {
+		c.A = out
+	}
+	if writesD {
+		c.D = out
+	}
+
+	if jump(out, instruction&0b111) {
+		c.PC = address
+	} else {
+		c.PC += 1
+	}
+	c.Cycles += 1
+	return nil
+}
+
+// alu computes comp bits c1..c6 with x and y like Hack ALU: zx nx zy ny f no
+func alu(x uint16, y uint16, comp uint16) uint16 {
+	if comp&0b100000 != 0 {
+		x = 0
+	}
+	if comp&0b010000 != 0 {
+		x = ^x
+	}
+	if comp&0b001000 != 0 {
+		y = 0
+	}
+	if comp&0b000100 != 0 {
+		y = ^y
+	}
+	var out uint16
+	if comp&0b000010 != 0 {
+		out = x + y
+	} else {
+		out = x & y
+	}
+	if comp&0b000001 != 0 {
+		out = ^out
+	}
+	return out
+}
+
+// jump reports whether the jump bits j1 j2 j3 jump with ALU output out.
+func jump(out uint16, bits uint16) bool {
+	negative, zero := int16(out) < 0, out == 0
+	return bits&0b100 != 0 && negative ||
+		bits&0b010 != 0 && zero ||
+		bits&0b001 != 0 && !negative && !zero
+}
+
+// Halted reports whether the program ended.
+// The program ends when PC is beyond the loaded program,
+// or when PC is at the conventional infinite loop of hack programs:
+//
+//	(END)
+//	@END
+//	0;JMP
+func (c *CPU) Halted() bool {
+	if int(c.PC) >= c.size {
+		return true
+	}
+	if int(c.PC)+1 >= ROMSize || c.ROM[c.PC] != c.PC {
+		return false
+	}
+	// unconditional jump which does not change A
+	next := c.ROM[c.PC+1]
+	return next>>13 == 0b111 && next&0b111 == 0b111 && next>>5&1 == 0
+}
+
+// Run executes instructions until the program halts.
+// It returns error when the program does not halt in maxCycles instructions.
+// maxCycles 0 means no limit.
+func (c *CPU) Run(maxCycles int) error {
+	for cycles := 0; !c.Halted(); cycles++ {
+		if maxCycles > 0 && cycles >= maxCycles {
+			return errors.New(fmt.Sprintf("program does not halt in %d cycles, PC is %d", maxCycles, c.PC))
+		}
+		if err := c.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
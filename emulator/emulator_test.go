@@ -0,0 +1,196 @@
+package emulator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fidemin/hack-assembler/assembler"
+)
+
+// assemble returns machine code of hack assembly source.
+func assemble(t *testing.T, source string) []uint16 {
+	t.Helper()
+	code := new(bytes.Buffer)
+	asm := assembler.New(strings.NewReader(source), code)
+	asm.Format = assembler.BinaryFormat
+	if err := asm.WriteBinaryCode(); err != nil {
+		t.Fatalf("assembler.WriteBinaryCode() results in error: %s", err)
+	}
+	words, err := assembler.BinaryFormat.(assembler.FormatReader).Read(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return words
+}
+
+// load returns *CPU with a program in testdata of assembler.
+func load(t *testing.T, name string) *CPU {
+	t.Helper()
+	source, err := ioutil.ReadFile(filepath.Join("..", "assembler", "testdata", name+".asm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu, err := New(assemble(t, string(source)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cpu
+}
+
+func TestCPU_Step(t *testing.T) {
+	tests := []struct {
+		source string
+		a      uint16
+		d      uint16
+		pc     uint16
+		ram    map[uint16]uint16
+	}{
+		{source: "@100", a: 100, pc: 1},
+		{source: "@7\nD=A\nD=D-1\n", a: 7, d: 6, pc: 3},
+		{source: "@7\nD=-A\n", a: 7, d: 0xfff9, pc: 2},
+		{source: "@3\nD=!A\nD=D|A\nAM=D&A\n", a: 3, d: 0xffff, pc: 4, ram: map[uint16]uint16{3: 3}},
+		{source: "@5\nM=1\nMD=M+1\nA=M-D\n", a: 0, d: 2, pc: 4, ram: map[uint16]uint16{5: 2}},
+		{source: "@5\nD=A\n@2\nD=D-A;JGT\n", a: 2, d: 3, pc: 2},
+		{source: "@5\nD=A\n@2\nD=A-D;JGE\n", a: 2, d: 0xfffd, pc: 4},
+		{source: "@9\nD=0;JEQ\n", a: 9, d: 0, pc: 9},
+		{source: "@9\nD=-1;JLT\n", a: 9, d: 0xffff, pc: 9},
+		// jump goes to A before the instruction
+		{source: "@9\nA=1;JMP\n", a: 1, pc: 9},
+	}
+
+	for _, test := range tests {
+		words := assemble(t, test.source)
+		cpu, err := New(words)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range words {
+			if err := cpu.Step(); err != nil {
+				t.Fatalf("%q: cpu.Step() results in error: %s", test.source, err)
+			}
+			if int(cpu.PC) >= len(words) {
+				break
+			}
+		}
+		if cpu.A != test.a || cpu.D != test.d || cpu.PC != test.pc {
+			t.Errorf("%q: A, D, PC = %d, %d, %d, want %d, %d, %d",
+				test.source, cpu.A, cpu.D, cpu.PC, test.a, test.d, test.pc)
+		}
+		for addr, wanted := range test.ram {
+			if cpu.RAM[addr] != wanted {
+				t.Errorf("%q: RAM[%d] = %d, want %d", test.source, addr, cpu.RAM[addr], wanted)
+			}
+		}
+	}
+}
+
+func TestCPU_Step_error(t *testing.T) {
+	cpu, err := New(assemble(t, "A=-1\nM=1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.Step(); err != nil {
+		t.Fatalf("cpu.Step() results in error: %s", err)
+	}
+	if err := cpu.Step(); err == nil {
+		t.Errorf("cpu.Step() should return error for RAM address %d", cpu.A)
+	}
+	if cpu.PC != 1 {
+		t.Errorf("cpu.PC = %d, should not change on error", cpu.PC)
+	}
+}
+
+func TestCPU_Run(t *testing.T) {
+	cpu := load(t, "Add")
+	if err := cpu.Run(100); err != nil {
+		t.Fatalf("cpu.Run() results in error: %s", err)
+	}
+	if cpu.RAM[0] != 5 {
+		t.Errorf("Add: RAM[0] = %d, want 5", cpu.RAM[0])
+	}
+
+	for _, test := range []struct{ r0, r1, wanted uint16 }{{3, 5, 5}, {9, 2, 9}} {
+		cpu = load(t, "Max")
+		cpu.RAM[0], cpu.RAM[1] = test.r0, test.r1
+		if err := cpu.Run(100); err != nil {
+			t.Fatalf("cpu.Run() results in error: %s", err)
+		}
+		if cpu.RAM[2] != test.wanted {
+			t.Errorf("Max(%d, %d): RAM[2] = %d, want %d", test.r0, test.r1, cpu.RAM[2], test.wanted)
+		}
+	}
+
+	cpu = load(t, "Rect")
+	cpu.RAM[0] = 4
+	if err := cpu.Run(1000); err != nil {
+		t.Fatalf("cpu.Run() results in error: %s", err)
+	}
+	for row := 0; row < 5; row++ {
+		wanted := uint16(0)
+		if row < 4 {
+			wanted = 0xffff
+		}
+		if got := cpu.RAM[Screen+row*32]; got != wanted {
+			t.Errorf("Rect: row %d of screen = %04x, want %04x", row, got, wanted)
+		}
+	}
+}
+
+func TestCPU_Run_negative(t *testing.T) {
+	cpu, err := New(assemble(t, "@-5\nD=A\n@R0\nM=D\n(END)\n@END\n0;JMP\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.Run(100); err != nil {
+		t.Fatalf("cpu.Run() results in error: %s", err)
+	}
+	if int16(cpu.RAM[0]) != -5 {
+		t.Errorf("RAM[0] = %d, want -5", int16(cpu.RAM[0]))
+	}
+}
+
+func TestCPU_Run_error(t *testing.T) {
+	cpu, err := New(assemble(t, "(LOOP)\n@LOOP\nD;JEQ\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.Run(10); err == nil {
+		t.Errorf("cpu.Run() should return error for a program which does not halt")
+	}
+	if cpu.Cycles != 10 {
+		t.Errorf("cpu.Cycles = %d, want 10", cpu.Cycles)
+	}
+
+	if _, err := New(make([]uint16, ROMSize+1)); err == nil {
+		t.Errorf("New() should return error for a program larger than ROM")
+	}
+}
+
+func TestCPU_Halted(t *testing.T) {
+	tests := []struct {
+		source string
+		pc     uint16
+		wanted bool
+	}{
+		{source: "(END)\n@END\n0;JMP\n", pc: 0, wanted: true},
+		{source: "@0\n(END)\n@END\n0;JMP\n", pc: 0, wanted: false},
+		{source: "@0\n(END)\n@END\n0;JMP\n", pc: 1, wanted: true},
+		// conditional jump can leave the loop
+		{source: "(END)\n@END\nD;JEQ\n", pc: 0, wanted: false},
+		{source: "@2\nD=A\n", pc: 2, wanted: true},
+	}
+
+	for _, test := range tests {
+		cpu, err := New(assemble(t, test.source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cpu.PC = test.pc
+		if got := cpu.Halted(); got != test.wanted {
+			t.Errorf("%q: cpu.Halted() at %d = %t, want %t", test.source, test.pc, got, test.wanted)
+		}
+	}
+}
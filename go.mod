@@ -1,3 +1,3 @@
 module github.com/fidemin/hack-assembler
 
-go 1.15
+go 1.16
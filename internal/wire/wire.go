@@ -0,0 +1,60 @@
+// Package wire reads and writes messages framed with Content-Length headers,
+// the base protocol of Debug Adapter Protocol and Language Server Protocol.
+package wire
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Read reads the content of the next message. It returns io.EOF when there is no more message.
+func Read(reader *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length < 0 {
+				return nil, io.EOF
+			}
+			return nil, errors.New(fmt.Sprintf("reading header: %s", err))
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			return nil, errors.New(fmt.Sprintf("invalid header %q", line))
+		}
+		// other headers like Content-Type are ignored
+		if strings.EqualFold(strings.TrimSpace(line[:colon]), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(line[colon+1:]))
+			if err != nil || length < 0 {
+				return nil, errors.New(fmt.Sprintf("invalid header %q", line))
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("missing Content-Length header")
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(reader, content); err != nil {
+		return nil, errors.New(fmt.Sprintf("reading content: %s", err))
+	}
+	return content, nil
+}
+
+// Write writes content as a message.
+func Write(writer io.Writer, content []byte) error {
+	if _, err := fmt.Fprintf(writer, "Content-Length: %d\r\n\r\n", len(content)); err != nil {
+		return err
+	}
+	_, err := writer.Write(content)
+	return err
+}
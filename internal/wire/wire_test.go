@@ -0,0 +1,52 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	input := "Content-Length: 2\r\n\r\n{}" +
+		"Content-Type: application/json\r\ncontent-length: 7\r\n\r\n{\"a\":1}"
+	reader := bufio.NewReader(strings.NewReader(input))
+	for _, wanted := range []string{"{}", "{\"a\":1}"} {
+		got, err := Read(reader)
+		if err != nil {
+			t.Fatalf("Read() results in error: %s", err)
+		}
+		if string(got) != wanted {
+			t.Errorf("Read() = %q, want %q", got, wanted)
+		}
+	}
+	if _, err := Read(reader); err != io.EOF {
+		t.Errorf("Read() = %v, want io.EOF", err)
+	}
+}
+
+func TestRead_error(t *testing.T) {
+	tests := []string{
+		"Content-Length: 10\r\n\r\n{}",
+		"Content-Length: x\r\n\r\n{}",
+		"Content-Type: application/json\r\n\r\n{}",
+		"Content-Length 2\r\n\r\n{}",
+		"Content-Length: 2\r\n",
+	}
+	for _, input := range tests {
+		if _, err := Read(bufio.NewReader(strings.NewReader(input))); err == nil || err == io.EOF {
+			t.Errorf("Read(%q) = %v, want error", input, err)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	writer := new(bytes.Buffer)
+	if err := Write(writer, []byte("{}")); err != nil {
+		t.Fatalf("Write() results in error: %s", err)
+	}
+	if got, wanted := writer.String(), "Content-Length: 2\r\n\r\n{}"; got != wanted {
+		t.Errorf("Write() = %q, want %q", got, wanted)
+	}
+}
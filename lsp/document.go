@@ -0,0 +1,280 @@
+package lsp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/fidemin/hack-assembler/assembler"
+)
+
+// symbolToken is a symbol in A command, label declaration or constant definition of a document.
+type symbolToken struct {
+	name string
+	pos  assembler.Position
+	// declaration is true for the symbol of label declaration or constant definition,
+	// e.g. LOOP of (LOOP) and N of .equ N 4
+	declaration bool
+}
+
+// document is an analyzed hack assembly source opened in the editor.
+type document struct {
+	uri   string
+	lines []string
+	// tokens are all symbol tokens in order of position
+	tokens      []symbolToken
+	parser      *assembler.Parser
+	diagnostics assembler.Diagnostics
+}
+
+// analyze assembles text in recover mode to collect diagnostics and symbols.
+// Files of .include are read from the disk for file URIs, relative to the document and then in includePath.
+func analyze(uri string, text string, includePath ...string) *document {
+	doc := &document{uri: uri, lines: strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")}
+
+	lexer := assembler.NewLexer(strings.NewReader(text), "")
+	// first is the first token of the line and n is the number of tokens after it
+	var first assembler.Token
+	n := 0
+	// symbols in macro bodies are parameters and local labels, not symbols of the program
+	inMacro := false
+	// macros are names of macros defined before the line
+	macros := map[string]bool{}
+	for token := lexer.Next(); token.Type != assembler.EOFToken; token = lexer.Next() {
+		if token.Type == assembler.NewlineToken {
+			first = assembler.Token{}
+			continue
+		}
+		if first.Type == "" {
+			first, n = token, 0
+			switch token.Text {
+			case ".macro":
+				inMacro = true
+			case ".endm":
+				inMacro = false
+			}
+			continue
+		}
+		n += 1
+		if token.Type != assembler.IdentToken {
+			continue
+		}
+		if first.Text == ".macro" && n == 1 {
+			macros[token.Text] = true
+		}
+		if inMacro {
+			continue
+		}
+		switch {
+		case first.Type == assembler.AtToken:
+			// symbols of A command, e.g. SCREEN and row of @SCREEN+32*row
+			doc.tokens = append(doc.tokens, symbolToken{name: token.Text, pos: token.Pos})
+		case first.Type == assembler.LParenToken && n == 1:
+			doc.tokens = append(doc.tokens, symbolToken{name: token.Text, pos: token.Pos, declaration: true})
+		case first.Text == ".equ" || first.Text == ".define":
+			// name and symbols in value of constant
+			doc.tokens = append(doc.tokens, symbolToken{name: token.Text, pos: token.Pos, declaration: n == 1})
+		case first.Type == assembler.IdentToken && macros[first.Text]:
+			// symbols in arguments of macro invocation, e.g. LOOP of GOTO LOOP
+			doc.tokens = append(doc.tokens, symbolToken{name: token.Text, pos: token.Pos})
+		}
+	}
+
+	asm := assembler.New(strings.NewReader(text), ioutil.Discard)
+	asm.Filename = uri
+	if file, ok := filePath(uri); ok {
+		asm.Filename = file
+		asm.FS = assembler.OSFS
+		asm.IncludePath = includePath
+	}
+	asm.Recover = true
+	// errors before the program ends are all reported
+	asm.MaxErrors = 0
+	asm.WriteBinaryCode()
+	doc.parser, doc.diagnostics = asm.Parser, asm.Diagnostics
+	return doc
+}
+
+// filePath returns the path in slash form of file URI.
+func filePath(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" || u.Path == "" {
+		return "", false
+	}
+	// file:///C:/Foo.asm on Windows
+	if len(u.Path) > 2 && u.Path[0] == '/' && u.Path[2] == ':' {
+		return u.Path[1:], true
+	}
+	return u.Path, true
+}
+
+// tokenAt returns the symbol token at 1-based line and byte column.
+func (d *document) tokenAt(line int, column int) (symbolToken, bool) {
+	for _, token := range d.tokens {
+		if token.pos.Line == line && token.pos.Column <= column && column <= token.pos.Column+len(token.name) {
+			return token, true
+		}
+	}
+	return symbolToken{}, false
+}
+
+// occurrences returns tokens of name. The declaration is included if includeDeclaration.
+func (d *document) occurrences(name string, includeDeclaration bool) []symbolToken {
+	var tokens []symbolToken
+	for _, token := range d.tokens {
+		if token.name == name && (includeDeclaration || !token.declaration) {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// declaration returns the token of label declaration or constant definition of name.
+func (d *document) declaration(name string) (symbolToken, bool) {
+	for _, token := range d.tokens {
+		if token.name == name && token.declaration {
+			return token, true
+		}
+	}
+	return symbolToken{}, false
+}
+
+// labels returns all labels declared in the document.
+func (d *document) labels() []string {
+	var labels []string
+	for _, token := range d.tokens {
+		if token.declaration && d.parser.IsLabel(token.name) {
+			labels = append(labels, token.name)
+		}
+	}
+	return labels
+}
+
+// constants returns all constants defined in the document.
+func (d *document) constants() []string {
+	var constants []string
+	for _, token := range d.tokens {
+		if token.declaration && d.parser.IsConstant(token.name) {
+			constants = append(constants, token.name)
+		}
+	}
+	return constants
+}
+
+// variables returns all variables of the document in order of their first use.
+func (d *document) variables() []string {
+	var variables []string
+	seen := map[string]bool{}
+	predefined := assembler.PredefinedSymbols()
+	for _, token := range d.tokens {
+		_, isPredefined := predefined[token.name]
+		if token.declaration || seen[token.name] || isPredefined || d.parser.IsLabel(token.name) || d.parser.IsConstant(token.name) {
+			continue
+		}
+		seen[token.name] = true
+		variables = append(variables, token.name)
+	}
+	return variables
+}
+
+// describe returns the kind and address of symbol, e.g. "label, ROM address 4".
+func (d *document) describe(name string) string {
+	addr, ok := d.parser.LookupSymbol(name)
+	if !ok {
+		return "undefined symbol"
+	}
+	if d.parser.IsLabel(name) {
+		return fmt.Sprintf("label, ROM address %d", addr)
+	}
+	if d.parser.IsConstant(name) {
+		return fmt.Sprintf("constant, value %d", addr)
+	}
+	if _, ok := assembler.PredefinedSymbols()[name]; ok {
+		return fmt.Sprintf("predefined symbol, address %d", addr)
+	}
+	return fmt.Sprintf("variable, RAM address %d", addr)
+}
+
+// commandAt returns A or C command at 1-based line.
+func (d *document) commandAt(line int) (assembler.Command, bool) {
+	for _, command := range d.parser.Commands {
+		// commands of included files have lines of other files
+		if command.Pos.Line == line && command.Pos.Source().IncludedFrom == nil && (command.CommandType == assembler.ACommand || command.CommandType == assembler.CCommand) {
+			return command, true
+		}
+	}
+	return assembler.Command{}, false
+}
+
+// toLSP converts 1-based line and byte column to 0-based LSP position counted in UTF-16 code units.
+func (d *document) toLSP(line int, column int) position {
+	if line < 1 {
+		return position{}
+	}
+	text := ""
+	if line <= len(d.lines) {
+		text = d.lines[line-1]
+	}
+	character := 0
+	for offset, r := range text {
+		if offset >= column-1 {
+			break
+		}
+		character += utf16Length(r)
+	}
+	return position{Line: line - 1, Character: character}
+}
+
+// fromLSP converts 0-based LSP position to 1-based line and byte column.
+func (d *document) fromLSP(pos position) (int, int) {
+	line := pos.Line + 1
+	if pos.Line < 0 || line > len(d.lines) {
+		return line, 1
+	}
+	text, character := d.lines[pos.Line], 0
+	for offset, r := range text {
+		if character >= pos.Character {
+			return line, offset + 1
+		}
+		character += utf16Length(r)
+	}
+	return line, len(text) + 1
+}
+
+func utf16Length(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// tokenRange returns the LSP range of token.
+func (d *document) tokenRange(token symbolToken) rangeType {
+	return rangeType{
+		Start: d.toLSP(token.pos.Line, token.pos.Column),
+		End:   d.toLSP(token.pos.Line, token.pos.Column+len(token.name)),
+	}
+}
+
+// diagnosticRange returns the LSP range of the word at the position of a diagnostic.
+func (d *document) diagnosticRange(pos assembler.Position) rangeType {
+	start := d.toLSP(pos.Line, pos.Column)
+	end := start
+	if pos.Line >= 1 && pos.Line <= len(d.lines) {
+		text, column := d.lines[pos.Line-1], pos.Column
+		if column < 1 {
+			column = 1
+		}
+		length := len(strings.TrimRight(text, " \t"))
+		// the rest of the command without comment
+		if comment := strings.Index(text, "//"); comment >= 0 {
+			length = len(strings.TrimRight(text[:comment], " \t"))
+		}
+		if length < column {
+			length = column
+		}
+		end = d.toLSP(pos.Line, length+1)
+	}
+	return rangeType{Start: start, End: end}
+}
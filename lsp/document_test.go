@@ -0,0 +1,143 @@
+package lsp
+
+import (
+	"reflect"
+	"testing"
+)
+
+const source = `// loop
+	@i
+	M=1
+(LOOP)
+	@i
+	D=M
+	@LOOP
+	D;JGT
+	@SCREEN
+	M=D // é
+`
+
+func TestAnalyze(t *testing.T) {
+	doc := analyze("file:///Loop.asm", source)
+
+	var names []string
+	for _, token := range doc.tokens {
+		names = append(names, token.name)
+	}
+	if wanted := []string{"i", "LOOP", "i", "LOOP", "SCREEN"}; !reflect.DeepEqual(names, wanted) {
+		t.Errorf("doc.tokens = %v, want %v", names, wanted)
+	}
+	if !doc.tokens[1].declaration || doc.tokens[3].declaration {
+		t.Errorf("only (LOOP) should be declaration: %+v", doc.tokens)
+	}
+	if len(doc.diagnostics) != 0 {
+		t.Errorf("doc.diagnostics = %s, want none", doc.diagnostics)
+	}
+
+	if got := doc.labels(); !reflect.DeepEqual(got, []string{"LOOP"}) {
+		t.Errorf("doc.labels() = %v, want [LOOP]", got)
+	}
+	if got := doc.variables(); !reflect.DeepEqual(got, []string{"i"}) {
+		t.Errorf("doc.variables() = %v, want [i]", got)
+	}
+
+	tests := []struct {
+		name   string
+		wanted string
+	}{
+		{name: "LOOP", wanted: "label, ROM address 2"},
+		{name: "i", wanted: "variable, RAM address 16"},
+		{name: "SCREEN", wanted: "predefined symbol, address 16384"},
+		{name: "j", wanted: "undefined symbol"},
+	}
+	for _, test := range tests {
+		if got := doc.describe(test.name); got != test.wanted {
+			t.Errorf("doc.describe(%s) = %q, want %q", test.name, got, test.wanted)
+		}
+	}
+}
+
+func TestAnalyze_constant(t *testing.T) {
+	doc := analyze("file:///Fill.asm", ".equ WORDS 8192\n.define LAST WORDS\n@LAST\nD=A\n@(i+LAST)\n")
+
+	var names []string
+	for _, token := range doc.tokens {
+		names = append(names, token.name)
+	}
+	if wanted := []string{"WORDS", "LAST", "WORDS", "LAST", "i", "LAST"}; !reflect.DeepEqual(names, wanted) {
+		t.Errorf("doc.tokens = %v, want %v", names, wanted)
+	}
+	if !doc.tokens[0].declaration || !doc.tokens[1].declaration || doc.tokens[2].declaration || doc.tokens[4].declaration {
+		t.Errorf("only constant names should be declarations: %+v", doc.tokens)
+	}
+	if got := doc.constants(); !reflect.DeepEqual(got, []string{"WORDS", "LAST"}) {
+		t.Errorf("doc.constants() = %v, want [WORDS LAST]", got)
+	}
+	if got := doc.variables(); !reflect.DeepEqual(got, []string{"i"}) {
+		t.Errorf("doc.variables() = %v, want [i]", got)
+	}
+	if got, wanted := doc.describe("LAST"), "constant, value 8192"; got != wanted {
+		t.Errorf("doc.describe(LAST) = %q, want %q", got, wanted)
+	}
+}
+
+func TestAnalyze_macro(t *testing.T) {
+	doc := analyze("file:///Wait.asm", ".macro WAIT n\n(LOOP)\n@n\n@LOOP\n.endm\nWAIT 2\n(END)\n@END\n")
+
+	var names []string
+	for _, token := range doc.tokens {
+		names = append(names, token.name)
+	}
+	if wanted := []string{"END", "END"}; !reflect.DeepEqual(names, wanted) {
+		t.Errorf("doc.tokens = %v, want %v", names, wanted)
+	}
+	if len(doc.diagnostics) != 0 {
+		t.Errorf("doc.diagnostics = %v, want none", doc.diagnostics)
+	}
+}
+
+func TestDocument_tokenAt(t *testing.T) {
+	doc := analyze("file:///Loop.asm", source)
+	tests := []struct {
+		line   int
+		column int
+		wanted string
+		ok     bool
+	}{
+		{line: 4, column: 2, wanted: "LOOP", ok: true},
+		{line: 7, column: 6, wanted: "LOOP", ok: true},
+		{line: 7, column: 7, wanted: "LOOP", ok: true},
+		{line: 7, column: 8, ok: false},
+		{line: 8, column: 2, ok: false},
+	}
+	for _, test := range tests {
+		token, ok := doc.tokenAt(test.line, test.column)
+		if ok != test.ok || token.name != test.wanted {
+			t.Errorf("doc.tokenAt(%d, %d) = %s, %t, want %s, %t", test.line, test.column, token.name, ok, test.wanted, test.ok)
+		}
+	}
+}
+
+func TestDocument_toLSP(t *testing.T) {
+	doc := analyze("file:///Foo.asm", "@a // é😀x\n")
+	tests := []struct {
+		column int
+		wanted position
+	}{
+		{column: 1, wanted: position{Line: 0, Character: 0}},
+		// é is 2 bytes and 1 UTF-16 code unit, 😀 is 4 bytes and 2 UTF-16 code units
+		{column: 7, wanted: position{Line: 0, Character: 6}},
+		{column: 9, wanted: position{Line: 0, Character: 7}},
+		{column: 13, wanted: position{Line: 0, Character: 9}},
+		{column: 14, wanted: position{Line: 0, Character: 10}},
+	}
+	for _, test := range tests {
+		got := doc.toLSP(1, test.column)
+		if got != test.wanted {
+			t.Errorf("doc.toLSP(1, %d) = %+v, want %+v", test.column, got, test.wanted)
+		}
+		if line, column := doc.fromLSP(got); line != 1 || column != test.column {
+			t.Errorf("doc.fromLSP(%+v) = %d, %d, want 1, %d", got, line, column, test.column)
+		}
+	}
+}
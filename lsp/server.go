@@ -0,0 +1,481 @@
+// Package lsp is a Language Server Protocol server for hack assembly.
+//
+// It publishes diagnostics of the assembler, and supports go to definition, find references,
+// hover, completion and rename of labels. Documents are synchronized in full.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/fidemin/hack-assembler/assembler"
+	"github.com/fidemin/hack-assembler/internal/wire"
+)
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeRequestFailed  = -32803
+)
+
+// completion item kinds of LSP
+const (
+	kindVariable  = 6
+	kindKeyword   = 14
+	kindReference = 18
+	kindConstant  = 21
+)
+
+// diagnostic severities of LSP
+const (
+	severityError   = 1
+	severityWarning = 2
+)
+
+// message is a JSON-RPC request, notification or response.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *responseError  `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *responseError) Error() string {
+	return e.Message
+}
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type rangeType struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type location struct {
+	URI   string    `json:"uri"`
+	Range rangeType `json:"range"`
+}
+
+type textEdit struct {
+	Range   rangeType `json:"range"`
+	NewText string    `json:"newText"`
+}
+
+type completionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type diagnostic struct {
+	Range    rangeType `json:"range"`
+	Severity int       `json:"severity"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"`
+}
+
+// textDocumentPosition is the params of requests at a position of a document.
+type textDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position position `json:"position"`
+}
+
+// Server serves a language server session over reader and writer, e.g. stdin and stdout.
+type Server struct {
+	reader    *bufio.Reader
+	writer    io.Writer
+	documents map[string]*document
+	shutdown  bool
+	// includePath is given by initializationOptions of initialize request
+	includePath []string
+}
+
+// NewServer returns *Server reading messages from reader and writing messages to writer.
+func NewServer(reader io.Reader, writer io.Writer) *Server {
+	return &Server{
+		reader:    bufio.NewReader(reader),
+		writer:    writer,
+		documents: map[string]*document{},
+	}
+}
+
+// Serve handles messages until exit notification or the end of reader.
+// It returns error when exit comes without shutdown request.
+func (s *Server) Serve() error {
+	for {
+		content, err := wire.Read(s.reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var request message
+		if err := json.Unmarshal(content, &request); err != nil {
+			if err := s.respond(nil, nil, &responseError{Code: codeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if request.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit without shutdown")
+			}
+			return nil
+		}
+
+		result, err := s.handle(request)
+		var respErr *responseError
+		// notifications have no response, and only errors of writing stop serving
+		if request.ID == nil {
+			if err != nil && !errors.As(err, &respErr) {
+				return err
+			}
+			continue
+		}
+		if err != nil && !errors.As(err, &respErr) {
+			respErr = &responseError{Code: codeRequestFailed, Message: err.Error()}
+		}
+		if err := s.respond(request.ID, result, respErr); err != nil {
+			return err
+		}
+	}
+}
+
+// handle handles request or notification and returns the result of response.
+func (s *Server) handle(request message) (interface{}, error) {
+	switch request.Method {
+	case "initialize":
+		var params struct {
+			InitializationOptions struct {
+				// IncludePath is the directories searched for included files
+				IncludePath []string `json:"includePath"`
+			} `json:"initializationOptions"`
+		}
+		if len(request.Params) > 0 {
+			if err := json.Unmarshal(request.Params, &params); err != nil {
+				return nil, err
+			}
+		}
+		s.includePath = params.InitializationOptions.IncludePath
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				// full document sync
+				"textDocumentSync":   1,
+				"definitionProvider": true,
+				"referencesProvider": true,
+				"hoverProvider":      true,
+				"renameProvider":     true,
+				"completionProvider": map[string]interface{}{"triggerCharacters": []string{"@", "=", ";"}},
+			},
+			"serverInfo": map[string]interface{}{"name": "hackasm"},
+		}, nil
+	case "initialized", "$/cancelRequest", "textDocument/didSave":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		return nil, s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		// the last change has the whole text in full sync
+		return nil, s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return nil, s.publishDiagnostics(params.TextDocument.URI, []diagnostic{})
+	case "textDocument/definition":
+		return s.positionRequest(request, s.definition)
+	case "textDocument/references":
+		return s.positionRequest(request, s.references)
+	case "textDocument/hover":
+		return s.positionRequest(request, s.hover)
+	case "textDocument/completion":
+		return s.positionRequest(request, s.completion)
+	case "textDocument/rename":
+		return s.positionRequest(request, s.rename)
+	}
+
+	if request.ID == nil {
+		// unknown notifications are ignored
+		return nil, nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %q is not supported", request.Method)}
+}
+
+// positionRequest decodes params of request at a position and calls handler with its document.
+func (s *Server) positionRequest(request message,
+	handler func(doc *document, line int, column int, params json.RawMessage) (interface{}, error)) (interface{}, error) {
+	var params textDocumentPosition
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidParams, Message: fmt.Sprintf("document %s is not open", params.TextDocument.URI)}
+	}
+	line, column := doc.fromLSP(params.Position)
+	return handler(doc, line, column, request.Params)
+}
+
+// update analyzes the document and publishes its diagnostics.
+func (s *Server) update(uri string, text string) error {
+	doc := analyze(uri, text, s.includePath...)
+	s.documents[uri] = doc
+
+	diagnostics := []diagnostic{}
+	for _, d := range doc.diagnostics {
+		severity := severityError
+		if d.Severity == assembler.SeverityWarning {
+			severity = severityWarning
+		}
+		pos, message := d.Pos, d.Message
+		if d.Pos.Source().IncludedFrom != nil {
+			// errors of included files are shown at .include with their positions
+			pos, message = d.Pos.Main(), fmt.Sprintf("%s: %s", d.Pos, d.Message)
+		}
+		diagnostics = append(diagnostics, diagnostic{
+			Range:    doc.diagnosticRange(pos),
+			Severity: severity,
+			Source:   "hackasm",
+			Message:  message,
+		})
+	}
+	return s.publishDiagnostics(uri, diagnostics)
+}
+
+func (s *Server) publishDiagnostics(uri string, diagnostics []diagnostic) error {
+	params, err := json.Marshal(map[string]interface{}{"uri": uri, "diagnostics": diagnostics})
+	if err != nil {
+		return err
+	}
+	return s.send(message{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics", Params: params})
+}
+
+// definition returns the location of label declaration of the symbol at the position.
+func (s *Server) definition(doc *document, line int, column int, _ json.RawMessage) (interface{}, error) {
+	token, ok := doc.tokenAt(line, column)
+	if !ok {
+		return nil, nil
+	}
+	declaration, ok := doc.declaration(token.name)
+	if !ok {
+		return nil, nil
+	}
+	return location{URI: doc.uri, Range: doc.tokenRange(declaration)}, nil
+}
+
+// references returns locations of the symbol at the position.
+func (s *Server) references(doc *document, line int, column int, rawParams json.RawMessage) (interface{}, error) {
+	var params struct {
+		Context struct {
+			IncludeDeclaration bool `json:"includeDeclaration"`
+		} `json:"context"`
+	}
+	if err := json.Unmarshal(rawParams, &params); err != nil {
+		return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	token, ok := doc.tokenAt(line, column)
+	if !ok {
+		return nil, nil
+	}
+	locations := []location{}
+	for _, occurrence := range doc.occurrences(token.name, params.Context.IncludeDeclaration) {
+		locations = append(locations, location{URI: doc.uri, Range: doc.tokenRange(occurrence)})
+	}
+	return locations, nil
+}
+
+// hover shows the address of the symbol at the position and the machine code of the command of the line.
+func (s *Server) hover(doc *document, line int, column int, _ json.RawMessage) (interface{}, error) {
+	var parts []string
+	token, onToken := doc.tokenAt(line, column)
+	if onToken {
+		parts = append(parts, fmt.Sprintf("`%s`: %s", token.name, doc.describe(token.name)))
+	}
+	if command, ok := doc.commandAt(line); ok {
+		if word, err := assembler.EncodeCommand(command); err == nil {
+			parts = append(parts, fmt.Sprintf("`%016b` (0x%04x)", word, word))
+		}
+	}
+	if len(parts) == 0 {
+		return nil, nil
+	}
+
+	result := map[string]interface{}{
+		"contents": map[string]interface{}{"kind": "markdown", "value": strings.Join(parts, "\n\n")},
+	}
+	if onToken {
+		result["range"] = doc.tokenRange(token)
+	}
+	return result, nil
+}
+
+// completion returns symbols after "@", jumps after ";", comps after "=", or dests and comps otherwise.
+func (s *Server) completion(doc *document, line int, column int, _ json.RawMessage) (interface{}, error) {
+	before := ""
+	if line >= 1 && line <= len(doc.lines) {
+		text := doc.lines[line-1]
+		if column-1 <= len(text) {
+			before = text[:column-1]
+		}
+	}
+	if strings.Contains(before, "//") {
+		return []completionItem{}, nil
+	}
+	before = strings.TrimLeft(before, " \t")
+
+	items := []completionItem{}
+	switch {
+	case strings.HasPrefix(before, "@"):
+		for _, label := range doc.labels() {
+			items = append(items, completionItem{Label: label, Kind: kindReference, Detail: doc.describe(label)})
+		}
+		for _, constant := range doc.constants() {
+			items = append(items, completionItem{Label: constant, Kind: kindConstant, Detail: doc.describe(constant)})
+		}
+		for _, variable := range doc.variables() {
+			items = append(items, completionItem{Label: variable, Kind: kindVariable, Detail: doc.describe(variable)})
+		}
+		predefined := assembler.PredefinedSymbols()
+		var names []string
+		for name := range predefined {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if predefined[names[i]] != predefined[names[j]] {
+				return predefined[names[i]] < predefined[names[j]]
+			}
+			return names[i] < names[j]
+		})
+		for _, name := range names {
+			items = append(items, completionItem{Label: name, Kind: kindConstant, Detail: fmt.Sprintf("predefined symbol, address %d", predefined[name])})
+		}
+	case strings.HasPrefix(before, "("):
+	case strings.Contains(before, ";"):
+		for _, jump := range assembler.JumpMnemonics() {
+			items = append(items, completionItem{Label: jump, Kind: kindKeyword, Detail: "jump"})
+		}
+	case strings.Contains(before, "="):
+		for _, comp := range assembler.CompMnemonics() {
+			items = append(items, completionItem{Label: comp, Kind: kindKeyword, Detail: "comp"})
+		}
+	default:
+		for _, dest := range assembler.DestMnemonics() {
+			items = append(items, completionItem{Label: dest + "=", Kind: kindKeyword, Detail: "dest"})
+		}
+		for _, comp := range assembler.CompMnemonics() {
+			items = append(items, completionItem{Label: comp, Kind: kindKeyword, Detail: "comp"})
+		}
+	}
+	return items, nil
+}
+
+// rename renames the label at the position and all its uses.
+func (s *Server) rename(doc *document, line int, column int, rawParams json.RawMessage) (interface{}, error) {
+	var params struct {
+		NewName string `json:"newName"`
+	}
+	if err := json.Unmarshal(rawParams, &params); err != nil {
+		return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	token, ok := doc.tokenAt(line, column)
+	if !ok || !doc.parser.IsLabel(token.name) {
+		return nil, errors.New("only labels can be renamed")
+	}
+	if err := validateLabel(params.NewName); err != nil {
+		return nil, err
+	}
+	if _, ok := doc.parser.LookupSymbol(params.NewName); ok {
+		return nil, errors.New(fmt.Sprintf("symbol %q already exists", params.NewName))
+	}
+
+	edits := []textEdit{}
+	for _, occurrence := range doc.occurrences(token.name, true) {
+		edits = append(edits, textEdit{Range: doc.tokenRange(occurrence), NewText: params.NewName})
+	}
+	return map[string]interface{}{"changes": map[string][]textEdit{doc.uri: edits}}, nil
+}
+
+// validateLabel checks name can be a label by parsing it as a label declaration.
+func validateLabel(name string) error {
+	parser := assembler.NewParser(strings.NewReader("(" + name + ")"))
+	parser.Filename = "rename"
+	if err := parser.Parse(); err != nil || len(parser.Commands) != 1 {
+		return errors.New(fmt.Sprintf("%q is not a valid label", name))
+	}
+	return nil
+}
+
+func (s *Server) respond(id json.RawMessage, result interface{}, respErr *responseError) error {
+	response := message{JSONRPC: "2.0", ID: id, Error: respErr}
+	if id == nil {
+		response.ID = json.RawMessage("null")
+	}
+	if respErr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		response.Result = data
+	}
+	return s.send(response)
+}
+
+func (s *Server) send(m message) error {
+	content, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return wire.Write(s.writer, content)
+}
@@ -0,0 +1,350 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fidemin/hack-assembler/internal/wire"
+)
+
+const uri = "file:///Loop.asm"
+
+// client is a LSP client talking with Server.
+type client struct {
+	t      *testing.T
+	writer io.WriteCloser
+	reader *bufio.Reader
+	id     int
+	done   chan error
+	// diagnostics are params of the last publishDiagnostics notification
+	diagnostics map[string]interface{}
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+	serverReader, clientWriter := io.Pipe()
+	clientReader, serverWriter := io.Pipe()
+	c := &client{t: t, writer: clientWriter, reader: bufio.NewReader(clientReader), done: make(chan error, 1)}
+	go func() {
+		err := NewServer(serverReader, serverWriter).Serve()
+		serverWriter.Close()
+		c.done <- err
+	}()
+	c.request("initialize", map[string]interface{}{})
+	c.notify("initialized", map[string]interface{}{})
+	return c
+}
+
+func (c *client) send(m message) {
+	c.t.Helper()
+	m.JSONRPC = "2.0"
+	content, err := json.Marshal(m)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := wire.Write(c.writer, content); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+	data, err := json.Marshal(params)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.send(message{Method: method, Params: data})
+}
+
+// request sends a request and returns its response.
+func (c *client) request(method string, params interface{}) message {
+	c.t.Helper()
+	c.id += 1
+	data, err := json.Marshal(params)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	id, _ := json.Marshal(c.id)
+	c.send(message{ID: id, Method: method, Params: data})
+	for {
+		m := c.receive()
+		if m.Method == "" {
+			if string(m.ID) != string(id) {
+				c.t.Fatalf("response id %s, want %s", m.ID, id)
+			}
+			return m
+		}
+	}
+}
+
+// result sends a request and decodes its result to v.
+func (c *client) result(method string, params interface{}, v interface{}) {
+	c.t.Helper()
+	response := c.request(method, params)
+	if response.Error != nil {
+		c.t.Fatalf("%s results in error: %s", method, response.Error.Message)
+	}
+	if err := json.Unmarshal(response.Result, v); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// receive receives a message. publishDiagnostics notification is recorded.
+func (c *client) receive() message {
+	c.t.Helper()
+	content, err := wire.Read(c.reader)
+	if err != nil {
+		c.t.Fatalf("reading message: %s", err)
+	}
+	var m message
+	if err := json.Unmarshal(content, &m); err != nil {
+		c.t.Fatal(err)
+	}
+	if m.Method == "textDocument/publishDiagnostics" {
+		c.diagnostics = nil
+		if err := json.Unmarshal(m.Params, &c.diagnostics); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	return m
+}
+
+// open opens a document and returns its diagnostics.
+func (c *client) open(text string) []interface{} {
+	c.t.Helper()
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "hack", "version": 1, "text": text},
+	})
+	c.receive()
+	return c.diagnostics["diagnostics"].([]interface{})
+}
+
+func (c *client) close() {
+	c.t.Helper()
+	c.request("shutdown", nil)
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		c.t.Errorf("Serve() results in error: %s", err)
+	}
+}
+
+// at returns params of a request at 0-based line and character.
+func at(line int, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     map[string]interface{}{"line": line, "character": character},
+	}
+}
+
+func TestServer_diagnostics(t *testing.T) {
+	c := newClient(t)
+	diagnostics := c.open("@i\nD=X\n(LOOP)\n@loop\n")
+	if len(diagnostics) != 2 {
+		t.Fatalf("diagnostics = %v, want 2 diagnostics", diagnostics)
+	}
+	first := diagnostics[0].(map[string]interface{})
+	start := first["range"].(map[string]interface{})["start"].(map[string]interface{})
+	if start["line"] != 1.0 || first["severity"] != 1.0 || !strings.Contains(first["message"].(string), "X") {
+		t.Errorf("diagnostics[0] = %v, want error at line 1", first)
+	}
+	if second := diagnostics[1].(map[string]interface{}); second["severity"] != 2.0 {
+		t.Errorf("diagnostics[1] = %v, want warning", second)
+	}
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []map[string]interface{}{{"text": "@i\nD=M\n"}},
+	})
+	c.receive()
+	if diagnostics := c.diagnostics["diagnostics"].([]interface{}); len(diagnostics) != 0 {
+		t.Errorf("diagnostics = %v, want none", diagnostics)
+	}
+	c.close()
+}
+
+func TestServer_definitionAndReferences(t *testing.T) {
+	c := newClient(t)
+	c.open(source)
+
+	var definition location
+	c.result("textDocument/definition", at(6, 3), &definition)
+	if wanted := (rangeType{Start: position{3, 1}, End: position{3, 5}}); definition.Range != wanted || definition.URI != uri {
+		t.Errorf("definition = %+v, want %+v", definition, wanted)
+	}
+
+	params := at(3, 2)
+	params["context"] = map[string]interface{}{"includeDeclaration": true}
+	var references []location
+	c.result("textDocument/references", params, &references)
+	if len(references) != 2 || references[1].Range.Start != (position{6, 2}) {
+		t.Errorf("references = %+v, want (LOOP) and @LOOP", references)
+	}
+
+	params["context"] = map[string]interface{}{"includeDeclaration": false}
+	c.result("textDocument/references", params, &references)
+	if len(references) != 1 {
+		t.Errorf("references = %+v, want @LOOP", references)
+	}
+	c.close()
+}
+
+func TestServer_hover(t *testing.T) {
+	c := newClient(t)
+	c.open(source)
+
+	var hover struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}
+	c.result("textDocument/hover", at(6, 3), &hover)
+	if wanted := "`LOOP`: label, ROM address 2\n\n`0000000000000010` (0x0002)"; hover.Contents.Value != wanted {
+		t.Errorf("hover = %q, want %q", hover.Contents.Value, wanted)
+	}
+	c.result("textDocument/hover", at(7, 1), &hover)
+	if wanted := "`1110001100000001` (0xe301)"; hover.Contents.Value != wanted {
+		t.Errorf("hover = %q, want %q", hover.Contents.Value, wanted)
+	}
+	c.close()
+}
+
+func TestServer_completion(t *testing.T) {
+	c := newClient(t)
+	c.open(source + "\t@\n\tD;\n\tAM=\n")
+
+	labels := func(line int, character int) []string {
+		var items []completionItem
+		c.result("textDocument/completion", at(line, character), &items)
+		var labels []string
+		for _, item := range items {
+			labels = append(labels, item.Label)
+		}
+		return labels
+	}
+
+	symbols := labels(10, 2)
+	if len(symbols) != 25 || symbols[0] != "LOOP" || symbols[1] != "i" || symbols[2] != "R0" {
+		t.Errorf("completion after @ = %v, want LOOP, i and predefined symbols", symbols)
+	}
+	if jumps := labels(11, 3); len(jumps) != 7 || jumps[0] != "JEQ" {
+		t.Errorf("completion after ; = %v, want jumps", jumps)
+	}
+	if comps := labels(12, 4); len(comps) != 28 {
+		t.Errorf("completion after = = %v, want comps", comps)
+	}
+	if items := labels(1, 1); len(items) != 35 || items[0] != "A=" {
+		t.Errorf("completion = %v, want dests and comps", items)
+	}
+	c.close()
+}
+
+func TestServer_diagnostics_include(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib")
+	if err := os.Mkdir(lib, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(lib, "bad.asm"), []byte("@1\nD=X\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newClient(t)
+	c.request("initialize", map[string]interface{}{"initializationOptions": map[string]interface{}{"includePath": []string{filepath.ToSlash(lib)}}})
+	main := "file://" + filepath.ToSlash(filepath.Join(dir, "Main.asm"))
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": main, "languageId": "hack", "version": 1, "text": "@1\n.include \"bad.asm\"\n"},
+	})
+	c.receive()
+
+	// the error of bad.asm is at .include
+	diagnostics := c.diagnostics["diagnostics"].([]interface{})
+	if len(diagnostics) != 1 {
+		t.Fatalf("diagnostics = %v, want 1 diagnostic", diagnostics)
+	}
+	first := diagnostics[0].(map[string]interface{})
+	start := first["range"].(map[string]interface{})["start"].(map[string]interface{})
+	wanted := filepath.ToSlash(filepath.Join(lib, "bad.asm")) + `:2:1: unknown comp "X"`
+	if start["line"] != 1.0 || first["message"] != wanted {
+		t.Errorf("diagnostics[0] = %v, want %q at line 1", first, wanted)
+	}
+	c.close()
+}
+
+func TestServer_rename(t *testing.T) {
+	c := newClient(t)
+	c.open(source)
+
+	params := at(6, 3)
+	params["newName"] = "AGAIN"
+	var edit struct {
+		Changes map[string][]textEdit `json:"changes"`
+	}
+	c.result("textDocument/rename", params, &edit)
+	edits := edit.Changes[uri]
+	if len(edits) != 2 || edits[0].NewText != "AGAIN" || edits[0].Range.Start != (position{3, 1}) {
+		t.Errorf("rename = %+v, want edits of (LOOP) and @LOOP", edits)
+	}
+
+	for _, test := range []struct {
+		line, character int
+		newName         string
+	}{
+		{line: 6, character: 3, newName: "1ABC"},
+		{line: 6, character: 3, newName: "i"},
+		{line: 1, character: 2, newName: "j"},
+	} {
+		params := at(test.line, test.character)
+		params["newName"] = test.newName
+		if response := c.request("textDocument/rename", params); response.Error == nil {
+			t.Errorf("rename to %s at %d:%d should fail", test.newName, test.line, test.character)
+		}
+	}
+	c.close()
+}
+
+func TestServer_rename_macroArgument(t *testing.T) {
+	c := newClient(t)
+	c.open(".macro GOTO label\n@label\n0;JMP\n.endm\n(LOOP)\nGOTO LOOP\n@LOOP\n")
+
+	params := at(4, 2)
+	params["newName"] = "TOP"
+	var edit struct {
+		Changes map[string][]textEdit `json:"changes"`
+	}
+	c.result("textDocument/rename", params, &edit)
+	var got []position
+	for _, e := range edit.Changes[uri] {
+		got = append(got, e.Range.Start)
+	}
+	// (LOOP), GOTO LOOP and @LOOP
+	if wanted := []position{{4, 1}, {5, 5}, {6, 1}}; !reflect.DeepEqual(got, wanted) {
+		t.Errorf("rename edits at %v, want %v", got, wanted)
+	}
+	c.close()
+}
+
+func TestServer_error(t *testing.T) {
+	c := newClient(t)
+	if response := c.request("textDocument/formatting", at(0, 0)); response.Error == nil || response.Error.Code != codeMethodNotFound {
+		t.Errorf("response = %+v, want method not found", response)
+	}
+	if response := c.request("textDocument/hover", at(0, 0)); response.Error == nil {
+		t.Errorf("hover of document not open should fail")
+	}
+
+	// malformed notifications are ignored
+	c.notify("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri, "text": 1}})
+	c.notify("textDocument/didChange", map[string]interface{}{"textDocument": "Loop.asm", "contentChanges": "@1"})
+	c.notify("textDocument/didClose", []int{1})
+	if response := c.request("textDocument/hover", at(0, 0)); response.Error == nil {
+		t.Errorf("hover of document not opened by malformed didOpen should fail")
+	}
+	c.close()
+}
@@ -0,0 +1,161 @@
+// Package sourcemap maps ROM addresses of assembled programs back to source lines.
+//
+// A source map is written as JSON:
+//
+//	{
+//	  "version": 1,
+//	  "file": "Foo.hack",
+//	  "sources": ["Foo.asm", "Foo.vm"],
+//	  "mappings": [
+//	    {"address": 0, "source": 0, "line": 1, "column": 1},
+//	    {"address": 1, "source": 0, "line": 3, "column": 1, "origin": {"source": 1, "line": 2}}
+//	  ]
+//	}
+//
+// version is always 1. file is the machine code file the map belongs to and
+// sources are the names of the source files. Every mapping has the ROM address
+// of a command and the index of its source file in sources with the line and
+// column of the command, starting from 1. Commands expanded from a macro are
+// mapped to the macro invocation. Mappings are sorted by address.
+//
+// origin is set for commands generated from another source, like .vm code
+// translated to assembly. It is given in the assembly by comments
+//
+//	//# source Foo.vm:2
+//
+// which set the origin of the following commands up to the next such comment.
+// A bare "//# source" comment clears the origin.
+package sourcemap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/fidemin/hack-assembler/assembler"
+)
+
+// Version is the version of the source map format.
+const Version = 1
+
+// SourceMap maps ROM addresses to source positions.
+type SourceMap struct {
+	Version  int       `json:"version"`
+	File     string    `json:"file,omitempty"`
+	Sources  []string  `json:"sources"`
+	Mappings []Mapping `json:"mappings"`
+}
+
+// Mapping is the source position of the command at Address.
+type Mapping struct {
+	Address uint16  `json:"address"`
+	Source  int     `json:"source"`
+	Line    int     `json:"line"`
+	Column  int     `json:"column,omitempty"`
+	Origin  *Origin `json:"origin,omitempty"`
+}
+
+// Origin is the position in the source the command was generated from.
+type Origin struct {
+	Source int `json:"source"`
+	Line   int `json:"line"`
+	Column int `json:"column,omitempty"`
+}
+
+// New creates the source map of commands parsed by assembler.Parser.
+// file is the name of the machine code file.
+func New(commands []assembler.Command, file string) *SourceMap {
+	m := &SourceMap{Version: Version, File: file, Sources: []string{}, Mappings: []Mapping{}}
+	index := map[string]int{}
+	source := func(name string) int {
+		i, ok := index[name]
+		if !ok {
+			i = len(m.Sources)
+			index[name] = i
+			m.Sources = append(m.Sources, name)
+		}
+		return i
+	}
+
+	var address uint16
+	for _, command := range commands {
+		if command.CommandType != assembler.ACommand && command.CommandType != assembler.CCommand {
+			continue
+		}
+		pos := command.Pos.Source()
+		mapping := Mapping{
+			Address: address,
+			Source:  source(pos.File),
+			Line:    pos.Line,
+			Column:  pos.Column,
+		}
+		if origin := command.Origin; origin.Line > 0 {
+			mapping.Origin = &Origin{Source: source(origin.File), Line: origin.Line, Column: origin.Column}
+		}
+		m.Mappings = append(m.Mappings, mapping)
+		address++
+	}
+	return m
+}
+
+// Read reads a source map in JSON.
+func Read(reader io.Reader) (*SourceMap, error) {
+	m := &SourceMap{}
+	if err := json.NewDecoder(reader).Decode(m); err != nil {
+		return nil, err
+	}
+	if m.Version != Version {
+		return nil, errors.New(fmt.Sprintf("unsupported source map version %d", m.Version))
+	}
+	for i, mapping := range m.Mappings {
+		if i > 0 && mapping.Address <= m.Mappings[i-1].Address {
+			return nil, errors.New(fmt.Sprintf("mapping of address %d is not sorted", mapping.Address))
+		}
+		if mapping.Source < 0 || mapping.Source >= len(m.Sources) {
+			return nil, errors.New(fmt.Sprintf("mapping of address %d has unknown source %d", mapping.Address, mapping.Source))
+		}
+		if origin := mapping.Origin; origin != nil && (origin.Source < 0 || origin.Source >= len(m.Sources)) {
+			return nil, errors.New(fmt.Sprintf("origin of address %d has unknown source %d", mapping.Address, origin.Source))
+		}
+	}
+	return m, nil
+}
+
+// Write writes the source map in JSON.
+func (m *SourceMap) Write(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(m)
+}
+
+// Lookup returns the source position of the command at address.
+func (m *SourceMap) Lookup(address uint16) (assembler.Position, bool) {
+	mapping, ok := m.mapping(address)
+	if !ok {
+		return assembler.Position{}, false
+	}
+	return assembler.Position{File: m.Sources[mapping.Source], Line: mapping.Line, Column: mapping.Column}, true
+}
+
+// LookupOrigin returns the position in the source the command at address was generated from.
+// It returns false when the command has no origin.
+func (m *SourceMap) LookupOrigin(address uint16) (assembler.Position, bool) {
+	mapping, ok := m.mapping(address)
+	if !ok || mapping.Origin == nil {
+		return assembler.Position{}, false
+	}
+	origin := mapping.Origin
+	return assembler.Position{File: m.Sources[origin.Source], Line: origin.Line, Column: origin.Column}, true
+}
+
+func (m *SourceMap) mapping(address uint16) (Mapping, bool) {
+	i := sort.Search(len(m.Mappings), func(i int) bool {
+		return m.Mappings[i].Address >= address
+	})
+	if i == len(m.Mappings) || m.Mappings[i].Address != address {
+		return Mapping{}, false
+	}
+	return m.Mappings[i], true
+}
@@ -0,0 +1,139 @@
+package sourcemap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fidemin/hack-assembler/assembler"
+)
+
+func parse(t *testing.T, source string) []assembler.Command {
+	t.Helper()
+	parser := assembler.NewParser(strings.NewReader(source))
+	parser.Filename = "Foo.asm"
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("parser.Parse() results in error: %s", err)
+	}
+	return parser.Commands
+}
+
+func TestNew(t *testing.T) {
+	commands := parse(t, `// push constant 7
+//# source Foo.vm:2
+@7
+  D=A
+(LOOP)
+//# source
+0;JMP
+`)
+	m := New(commands, "Foo.hack")
+
+	tests := []struct {
+		address uint16
+		wanted  assembler.Position
+		origin  assembler.Position
+		ok      bool
+	}{
+		{address: 0, wanted: assembler.Position{File: "Foo.asm", Line: 3, Column: 1}, origin: assembler.Position{File: "Foo.vm", Line: 2}, ok: true},
+		{address: 1, wanted: assembler.Position{File: "Foo.asm", Line: 4, Column: 3}, origin: assembler.Position{File: "Foo.vm", Line: 2}, ok: true},
+		{address: 2, wanted: assembler.Position{File: "Foo.asm", Line: 7, Column: 1}},
+		{address: 3},
+	}
+	for _, test := range tests {
+		got, ok := m.Lookup(test.address)
+		if got != test.wanted || ok != (test.wanted != assembler.Position{}) {
+			t.Errorf("Lookup(%d) = %+v, %t, want %+v", test.address, got, ok, test.wanted)
+		}
+		origin, ok := m.LookupOrigin(test.address)
+		if origin != test.origin || ok != test.ok {
+			t.Errorf("LookupOrigin(%d) = %+v, %t, want %+v, %t", test.address, origin, ok, test.origin, test.ok)
+		}
+	}
+}
+
+func TestNew_macro(t *testing.T) {
+	commands := parse(t, ".macro PUSH value\n@value\nD=A\n.endm\n@1\n  PUSH 7\n")
+	m := New(commands, "Foo.hack")
+
+	// commands expanded from PUSH are at the invocation
+	for address, wanted := range []assembler.Position{
+		{File: "Foo.asm", Line: 5, Column: 1},
+		{File: "Foo.asm", Line: 6, Column: 3},
+		{File: "Foo.asm", Line: 6, Column: 3},
+	} {
+		if got, ok := m.Lookup(uint16(address)); !ok || got != wanted {
+			t.Errorf("Lookup(%d) = %+v, %t, want %+v", address, got, ok, wanted)
+		}
+	}
+}
+
+func TestSourceMap_Write(t *testing.T) {
+	m := New(parse(t, "//# source Foo.vm:2:5\n@7\n//# source\nD=A\n"), "Foo.hack")
+	buf := new(bytes.Buffer)
+	if err := m.Write(buf); err != nil {
+		t.Fatalf("Write() results in error: %s", err)
+	}
+
+	wanted := `{
+  "version": 1,
+  "file": "Foo.hack",
+  "sources": [
+    "Foo.asm",
+    "Foo.vm"
+  ],
+  "mappings": [
+    {
+      "address": 0,
+      "source": 0,
+      "line": 2,
+      "column": 1,
+      "origin": {
+        "source": 1,
+        "line": 2,
+        "column": 5
+      }
+    },
+    {
+      "address": 1,
+      "source": 0,
+      "line": 4,
+      "column": 1
+    }
+  ]
+}
+`
+	if buf.String() != wanted {
+		t.Errorf("Write() = %s, want %s", buf, wanted)
+	}
+
+	read, err := Read(buf)
+	if err != nil {
+		t.Fatalf("Read() results in error: %s", err)
+	}
+	if got, ok := read.LookupOrigin(0); !ok || got != (assembler.Position{File: "Foo.vm", Line: 2, Column: 5}) {
+		t.Errorf("LookupOrigin(0) = %+v, %t after Read()", got, ok)
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		json  string
+		isErr bool
+	}{
+		{json: `{"version": 1, "sources": ["Foo.asm"], "mappings": [{"address": 0, "source": 0, "line": 1}]}`},
+		{json: `{"version": 2, "sources": [], "mappings": []}`, isErr: true},
+		{json: `{"version": 1, "sources": ["Foo.asm"], "mappings": [{"address": 0, "source": 1, "line": 1}]}`, isErr: true},
+		{json: `{"version": 1, "sources": ["Foo.asm"], "mappings": [{"address": 0, "source": 0, "line": 1, "origin": {"source": 3, "line": 1}}]}`, isErr: true},
+		{json: `{"version": 1, "sources": ["Foo.asm"], "mappings": [{"address": 1, "source": 0, "line": 1}, {"address": 0, "source": 0, "line": 2}]}`, isErr: true},
+		{json: `{"version": 1,`, isErr: true},
+	}
+	for _, test := range tests {
+		_, err := Read(strings.NewReader(test.json))
+		if test.isErr && err == nil {
+			t.Errorf("Read(%s): error should not be nil", test.json)
+		} else if !test.isErr && err != nil {
+			t.Errorf("Read(%s): unexpected error '%s'", test.json, err)
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package tst
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fidemin/hack-assembler/assembler"
+	"github.com/fidemin/hack-assembler/emulator"
+)
+
+// maxRepeat limits repeat without count and while, which can loop forever. They fail after that many loops.
+const maxRepeat = 10000000
+
+// Mismatch is the error of output line which differs from the compare file.
+type Mismatch struct {
+	// File is the compare file
+	File string
+	// Line is the line number of the compare file, starting from 1
+	Line int
+	Got  string
+	Want string
+}
+
+func (m *Mismatch) Error() string {
+	return fmt.Sprintf("%s:%d: comparison failure\n  got:  %s\n  want: %s", m.File, m.Line, m.Got, m.Want)
+}
+
+// Runner runs a test script of a hack assembly program with emulator.
+type Runner struct {
+	// Filename is the test script file. Files in the script are resolved relative to its directory.
+	Filename string
+	// Echo receives text of echo commands. It is ignored if nil.
+	Echo io.Writer
+	// IncludePath is the directories searched for files included by .asm programs
+	IncludePath []string
+	// Output has the output lines of the script after Run, including the header of output-list
+	Output []string
+	reader io.Reader
+
+	cpu        *emulator.CPU
+	columns    []column
+	outputFile string
+	// compare has lines of compareFile
+	compareFile string
+	compare     []string
+}
+
+// New returns *Runner running the test script read from reader.
+func New(reader io.Reader, filename string) *Runner {
+	return &Runner{reader: reader, Filename: filename}
+}
+
+// Run runs the test script. It returns *Mismatch for the first output line
+// which differs from the compare file. The output file is written even if it mismatches.
+func (r *Runner) Run() error {
+	statements, err := ParseScript(r.reader, r.Filename)
+	if err != nil {
+		return err
+	}
+
+	r.cpu, _ = emulator.New(nil)
+	r.Output = nil
+	err = r.execute(statements)
+	if r.outputFile != "" {
+		if writeErr := ioutil.WriteFile(r.outputFile, []byte(strings.Join(r.Output, "\n")+"\n"), 0644); err == nil {
+			err = writeErr
+		}
+	}
+	return err
+}
+
+func (r *Runner) execute(statements []Statement) error {
+	for _, statement := range statements {
+		if err := r.executeOne(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runner) executeOne(statement Statement) error {
+	errorf := func(format string, a ...interface{}) error {
+		return errors.New(fmt.Sprintf("%s: %s", statement.Pos, fmt.Sprintf(format, a...)))
+	}
+
+	switch statement.Name {
+	case "load":
+		words, err := load(r.path(statement.Args[0]), r.IncludePath)
+		if err != nil {
+			return errorf("%s", err)
+		}
+		if r.cpu, err = emulator.New(words); err != nil {
+			return errorf("%s", err)
+		}
+	case "output-file":
+		r.outputFile = r.path(statement.Args[0])
+	case "compare-to":
+		r.compareFile = r.path(statement.Args[0])
+		data, err := ioutil.ReadFile(r.compareFile)
+		if err != nil {
+			return errorf("%s", err)
+		}
+		r.compare = strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	case "output-list":
+		r.columns = nil
+		for _, arg := range statement.Args {
+			col, err := parseColumn(arg)
+			if err != nil {
+				return errorf("%s", err)
+			}
+			r.columns = append(r.columns, col)
+		}
+		return r.output(r.header())
+	case "output":
+		if r.columns == nil {
+			return errorf("output needs output-list")
+		}
+		line, err := r.line()
+		if err != nil {
+			return errorf("%s", err)
+		}
+		return r.output(line)
+	case "set":
+		value, err := parseValue(statement.Args[1])
+		if err != nil {
+			return errorf("%s", err)
+		}
+		if err := r.set(statement.Args[0], value); err != nil {
+			return errorf("%s", err)
+		}
+	case "ticktock", "tock":
+		// an instruction is executed per clock cycle, at tock
+		if err := r.cpu.Step(); err != nil {
+			return errorf("%s", err)
+		}
+	case "tick":
+	case "echo":
+		if r.Echo != nil {
+			fmt.Fprintln(r.Echo, statement.Args[0])
+		}
+	case "clear-echo":
+	case "repeat":
+		if len(statement.Args) == 1 {
+			count, _ := strconv.Atoi(statement.Args[0])
+			for i := 0; i < count; i++ {
+				if err := r.execute(statement.Body); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		// repeat without count never ends
+		for i := 0; i < maxRepeat; i++ {
+			if err := r.execute(statement.Body); err != nil {
+				return err
+			}
+		}
+		return errorf("repeat loops more than %d times", maxRepeat)
+	case "while":
+		for i := 0; ; i++ {
+			ok, err := r.condition(statement.Args)
+			if err != nil {
+				return errorf("%s", err)
+			}
+			if !ok {
+				break
+			}
+			if i == maxRepeat {
+				return errorf("while loops more than %d times", maxRepeat)
+			}
+			if err := r.execute(statement.Body); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// path resolves name relative to the directory of the script.
+func (r *Runner) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(filepath.Dir(r.Filename), name)
+}
+
+// load returns machine code of .asm file assembled by assembler, or machine code of other formats.
+// Files included by .asm file are searched in includePath after its directory.
+func load(path string, includePath []string) ([]uint16, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ext := filepath.Ext(path)
+	if ext != ".asm" {
+		format, err := assembler.LookupFormatByExtension(ext)
+		if err != nil {
+			return nil, err
+		}
+		reader, ok := format.(assembler.FormatReader)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("%s cannot be loaded", path))
+		}
+		return reader.Read(file)
+	}
+
+	code := new(bytes.Buffer)
+	asm := assembler.New(file, code)
+	asm.Filename = filepath.ToSlash(path)
+	asm.FS = assembler.OSFS
+	asm.IncludePath = includePath
+	asm.Format = assembler.BinaryFormat
+	if err := asm.WriteBinaryCode(); err != nil {
+		return nil, err
+	}
+	return assembler.BinaryFormat.(assembler.FormatReader).Read(code)
+}
+
+// output appends line to output and compares it with the compare file.
+func (r *Runner) output(line string) error {
+	r.Output = append(r.Output, line)
+	if r.compare == nil {
+		return nil
+	}
+	lineNumber := len(r.Output)
+	want := ""
+	if lineNumber <= len(r.compare) {
+		want = r.compare[lineNumber-1]
+	}
+	if !matchLine(line, want) {
+		return &Mismatch{File: r.compareFile, Line: lineNumber, Got: line, Want: want}
+	}
+	return nil
+}
+
+// matchLine reports whether line matches the line of compare file. "*" in want matches any character.
+func matchLine(line string, want string) bool {
+	if len(line) != len(want) {
+		return false
+	}
+	for i := 0; i < len(line); i++ {
+		if want[i] != '*' && want[i] != line[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// get returns the value of variable: A, D, PC, time, RAM[n] or ROM[n].
+func (r *Runner) get(variable string) (uint16, error) {
+	switch variable {
+	case "A":
+		return r.cpu.A, nil
+	case "D":
+		return r.cpu.D, nil
+	case "PC":
+		return r.cpu.PC, nil
+	case "time":
+		return uint16(r.cpu.Cycles), nil
+	}
+	memory, addr, err := r.memory(variable)
+	if err != nil {
+		return 0, err
+	}
+	return memory[addr], nil
+}
+
+// set sets the value of variable: A, D, PC, RAM[n] or ROM[n].
+func (r *Runner) set(variable string, value uint16) error {
+	switch variable {
+	case "A":
+		r.cpu.A = value
+		return nil
+	case "D":
+		r.cpu.D = value
+		return nil
+	case "PC":
+		r.cpu.PC = value
+		return nil
+	}
+	memory, addr, err := r.memory(variable)
+	if err != nil {
+		return err
+	}
+	memory[addr] = value
+	return nil
+}
+
+// memory returns the memory and address of RAM[n] or ROM[n].
+func (r *Runner) memory(variable string) ([]uint16, int, error) {
+	var memory []uint16
+	switch {
+	case strings.HasPrefix(variable, "RAM[") && strings.HasSuffix(variable, "]"):
+		memory = r.cpu.RAM[:]
+	case strings.HasPrefix(variable, "ROM[") && strings.HasSuffix(variable, "]"):
+		memory = r.cpu.ROM[:]
+	default:
+		return nil, 0, errors.New(fmt.Sprintf("unknown variable %q", variable))
+	}
+	addr, err := strconv.Atoi(variable[4 : len(variable)-1])
+	if err != nil || addr < 0 || addr >= len(memory) {
+		return nil, 0, errors.New(fmt.Sprintf("invalid address of %q", variable))
+	}
+	return memory, addr, nil
+}
+
+// condition evaluates condition of while: left, operator and right.
+func (r *Runner) condition(args []string) (bool, error) {
+	operands := make([]int, 2)
+	for i, arg := range []string{args[0], args[2]} {
+		value, err := parseValue(arg)
+		if err != nil {
+			if value, err = r.get(arg); err != nil {
+				return false, err
+			}
+		}
+		operands[i] = int(int16(value))
+	}
+
+	left, right := operands[0], operands[1]
+	switch args[1] {
+	case "=":
+		return left == right, nil
+	case "<>":
+		return left != right, nil
+	case "<":
+		return left < right, nil
+	case ">":
+		return left > right, nil
+	case "<=":
+		return left <= right, nil
+	case ">=":
+		return left >= right, nil
+	}
+	return false, errors.New(fmt.Sprintf("unknown operator %q", args[1]))
+}
+
+// parseValue parses number of test script: decimal like -1, or %D, %X and %B prefixed numbers.
+func parseValue(text string) (uint16, error) {
+	base, digits := 10, text
+	if len(text) > 2 && text[0] == '%' {
+		switch text[1] {
+		case 'D':
+			base = 10
+		case 'X':
+			base = 16
+		case 'B':
+			base = 2
+		default:
+			return 0, errors.New(fmt.Sprintf("invalid value %q", text))
+		}
+		digits = text[2:]
+	}
+	if base == 10 {
+		value, err := strconv.ParseInt(digits, 10, 32)
+		if err != nil || value < -32768 || value > 65535 {
+			return 0, errors.New(fmt.Sprintf("invalid value %q", text))
+		}
+		return uint16(value), nil
+	}
+	value, err := strconv.ParseUint(digits, base, 16)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("invalid value %q", text))
+	}
+	return uint16(value), nil
+}
+
+// column is a variable of output-list with its format, e.g. RAM[0]%D2.6.2
+type column struct {
+	variable string
+	// base is 'D', 'X', 'B' or 'S'
+	base     byte
+	padLeft  int
+	length   int
+	padRight int
+}
+
+// parseColumn parses a variable of output-list. The default format is %B1.16.1.
+func parseColumn(text string) (column, error) {
+	col := column{variable: text, base: 'B', padLeft: 1, length: 16, padRight: 1}
+	i := strings.IndexByte(text, '%')
+	if i < 0 {
+		return col, nil
+	}
+	col.variable = text[:i]
+	format := text[i+1:]
+	invalid := errors.New(fmt.Sprintf("invalid format of %q", text))
+	if len(format) < 1 || strings.IndexByte("DXBS", format[0]) < 0 {
+		return col, invalid
+	}
+	col.base = format[0]
+	parts := strings.Split(format[1:], ".")
+	if len(parts) != 3 {
+		return col, invalid
+	}
+	for j, p := range []*int{&col.padLeft, &col.length, &col.padRight} {
+		n, err := strconv.Atoi(parts[j])
+		if err != nil || n < 0 {
+			return col, invalid
+		}
+		*p = n
+	}
+	return col, nil
+}
+
+func (c column) width() int {
+	return c.padLeft + c.length + c.padRight
+}
+
+// format returns the cell of value with paddings.
+func (c column) format(value uint16) string {
+	var text string
+	switch c.base {
+	case 'D', 'S':
+		text = strconv.Itoa(int(int16(value)))
+	case 'X':
+		text = fmt.Sprintf("%04X", value)
+	case 'B':
+		text = fmt.Sprintf("%016b", value)
+	}
+	if len(text) > c.length {
+		// keep the least significant digits
+		text = text[len(text)-c.length:]
+	}
+	return strings.Repeat(" ", c.padLeft) + fmt.Sprintf("%*s", c.length, text) + strings.Repeat(" ", c.padRight)
+}
+
+// header returns the header line of output-list with centered variable names.
+func (r *Runner) header() string {
+	var builder strings.Builder
+	builder.WriteString("|")
+	for _, col := range r.columns {
+		name := col.variable
+		if len(name) > col.width() {
+			name = name[:col.width()]
+		}
+		left := (col.width() - len(name)) / 2
+		builder.WriteString(strings.Repeat(" ", left) + name + strings.Repeat(" ", col.width()-len(name)-left) + "|")
+	}
+	return builder.String()
+}
+
+// line returns the output line of output-list with the current values.
+func (r *Runner) line() (string, error) {
+	var builder strings.Builder
+	builder.WriteString("|")
+	for _, col := range r.columns {
+		value, err := r.get(col.variable)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteString(col.format(value) + "|")
+	}
+	return builder.String(), nil
+}
@@ -0,0 +1,121 @@
+package tst
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyTestdata copies files in testdata to a temporary directory, and returns the directory.
+func copyTestdata(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRunner_Run(t *testing.T) {
+	dir := copyTestdata(t, "Max.asm", "Max.tst", "Max.cmp")
+	script, err := os.Open(filepath.Join(dir, "Max.tst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer script.Close()
+
+	runner := New(script, filepath.Join(dir, "Max.tst"))
+	if err := runner.Run(); err != nil {
+		t.Fatalf("runner.Run() results in error: %s", err)
+	}
+
+	out, err := ioutil.ReadFile(filepath.Join(dir, "Max.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmp, _ := ioutil.ReadFile(filepath.Join(dir, "Max.cmp"))
+	if string(out) != string(cmp) {
+		t.Errorf("Max.out =\n%s\nwant\n%s", out, cmp)
+	}
+}
+
+func TestRunner_Run_mismatch(t *testing.T) {
+	dir := copyTestdata(t, "Max.asm")
+	cmp := "|  RAM[2]  |\n|       5  |\n|       7  |\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "Max.cmp"), []byte(cmp), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := `load Max.asm, compare-to Max.cmp, output-list RAM[2]%D2.6.2;
+set RAM[0] 5, set RAM[1] 3; repeat 20 { ticktock; } output;
+set PC 0, set RAM[0] 6; repeat 20 { ticktock; } output;`
+
+	runner := New(strings.NewReader(script), filepath.Join(dir, "Max.tst"))
+	err := runner.Run()
+	var mismatch *Mismatch
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("runner.Run() = %v, want *Mismatch", err)
+	}
+	wanted := Mismatch{File: filepath.Join(dir, "Max.cmp"), Line: 3, Got: "|       6  |", Want: "|       7  |"}
+	if *mismatch != wanted {
+		t.Errorf("runner.Run() = %+v, want %+v", *mismatch, wanted)
+	}
+}
+
+func TestRunner_Run_output(t *testing.T) {
+	script := `load Max.asm,
+output-list time%S1.4.1 PC%D1.3.1 A%X1.4.1 D%B1.8.1 RAM[0]%D1.6.1;
+set RAM[0] 300, set RAM[1] %B101;
+ticktock, ticktock; output;
+while PC <> 10 { ticktock; } output;
+echo "done";`
+	dir := copyTestdata(t, "Max.asm")
+	echo := new(bytes.Buffer)
+	runner := New(strings.NewReader(script), filepath.Join(dir, "Max.tst"))
+	runner.Echo = echo
+	if err := runner.Run(); err != nil {
+		t.Fatalf("runner.Run() results in error: %s", err)
+	}
+
+	wanted := []string{
+		"| time | PC  |  A   |    D     | RAM[0] |",
+		"|    2 |   2 | 0000 | 00101100 |    300 |",
+		"|    6 |  10 | 000A | 00100111 |    300 |",
+	}
+	if strings.Join(runner.Output, "\n") != strings.Join(wanted, "\n") {
+		t.Errorf("runner.Output =\n%s\nwant\n%s", strings.Join(runner.Output, "\n"), strings.Join(wanted, "\n"))
+	}
+	if echo.String() != "done\n" {
+		t.Errorf("echo = %q, want %q", echo, "done\n")
+	}
+}
+
+func TestRunner_Run_error(t *testing.T) {
+	dir := copyTestdata(t, "Max.asm")
+	tests := []string{
+		"load Foo.asm;",
+		"output;",
+		"set RAM[32768] 1;",
+		"set X 1;",
+		"set RAM[0] 70000;",
+		"output-list RAM[0]%Q1.6.1;",
+		"load Max.asm; while PC >< 0 { ticktock; }",
+		"load Max.asm; repeat { ticktock; }",
+	}
+
+	for _, script := range tests {
+		runner := New(strings.NewReader(script), filepath.Join(dir, "Foo.tst"))
+		if err := runner.Run(); err == nil {
+			t.Errorf("runner.Run() should return error for %q", script)
+		}
+	}
+}
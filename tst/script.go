@@ -0,0 +1,202 @@
+// Package tst runs Nand2Tetris test scripts (.tst) of hack assembly programs
+// and compares their output with .cmp files like CPUEmulator of Nand2Tetris.
+package tst
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/fidemin/hack-assembler/assembler"
+)
+
+// Statement is a command of test script, e.g. "set RAM[0] 3," or "repeat 10 { ticktock; }".
+type Statement struct {
+	// Name is the command name, e.g. "set", "repeat" and "while"
+	Name string
+	// Args are the arguments after the name. For while, they are the condition: left, operator and right.
+	// For repeat, Args is empty or the count.
+	Args []string
+	// Body has statements in { } of repeat and while
+	Body []Statement
+	Pos  assembler.Position
+}
+
+// scriptToken is a word, a string or one of ",;!{}" of test script.
+type scriptToken struct {
+	text string
+	// quoted is true for "string" tokens. text does not include the quotes.
+	quoted bool
+	pos    assembler.Position
+}
+
+// isTerminator reports whether token ends a command.
+func (t scriptToken) isTerminator() bool {
+	return !t.quoted && (t.text == "," || t.text == ";" || t.text == "!")
+}
+
+// ParseScript parses test script read from reader. filename is used for positions of errors.
+func ParseScript(reader io.Reader, filename string) ([]Statement, error) {
+	source, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := tokenizeScript(string(source), filename)
+	if err != nil {
+		return nil, err
+	}
+	statements, rest, err := parseStatements(tokens, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New(fmt.Sprintf("%s: unexpected %q", rest[0].pos, rest[0].text))
+	}
+	return statements, nil
+}
+
+// tokenizeScript splits source into tokens, removing // and /* */ comments.
+func tokenizeScript(source string, filename string) ([]scriptToken, error) {
+	var tokens []scriptToken
+	line, column := 1, 1
+	for i := 0; i < len(source); {
+		pos := assembler.Position{File: filename, Line: line, Column: column}
+		c := source[i]
+		// length is the length of the token or the skipped text
+		length := 1
+		switch {
+		case c == '\n':
+			line, column = line+1, 0
+		case c == ' ' || c == '\t' || c == '\r':
+		case strings.HasPrefix(source[i:], "//"):
+			length = strings.IndexByte(source[i:], '\n')
+			if length < 0 {
+				length = len(source) - i
+			}
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i+2:], "*/")
+			if end < 0 {
+				return nil, errors.New(fmt.Sprintf("%s: unterminated comment", pos))
+			}
+			length = end + 4
+			comment := source[i : i+length]
+			if lines := strings.Count(comment, "\n"); lines > 0 {
+				line += lines
+				column = len(comment) - strings.LastIndexByte(comment, '\n')
+				i += length
+				continue
+			}
+		case c == '"':
+			end := strings.IndexAny(source[i+1:], "\"\n")
+			if end < 0 || source[i+1+end] != '"' {
+				return nil, errors.New(fmt.Sprintf("%s: unterminated string", pos))
+			}
+			length = end + 2
+			tokens = append(tokens, scriptToken{text: source[i+1 : i+1+end], quoted: true, pos: pos})
+		case strings.IndexByte(",;!{}", c) >= 0:
+			tokens = append(tokens, scriptToken{text: source[i : i+1], pos: pos})
+		default:
+			length = 0
+			for i+length < len(source) && strings.IndexByte(" \t\r\n,;!{}\"", source[i+length]) < 0 &&
+				!strings.HasPrefix(source[i+length:], "//") && !strings.HasPrefix(source[i+length:], "/*") {
+				length += 1
+			}
+			tokens = append(tokens, scriptToken{text: source[i : i+length], pos: pos})
+		}
+		i += length
+		column += length
+	}
+	return tokens, nil
+}
+
+// parseStatements parses statements until "}" if inBlock, or until the end of tokens.
+// It returns tokens after the statements.
+func parseStatements(tokens []scriptToken, inBlock bool) ([]Statement, []scriptToken, error) {
+	var statements []Statement
+	for len(tokens) > 0 {
+		first := tokens[0]
+		switch {
+		case first.isTerminator():
+			// empty command
+			tokens = tokens[1:]
+			continue
+		case first.text == "}" && !first.quoted:
+			if !inBlock {
+				return nil, nil, errors.New(fmt.Sprintf("%s: unexpected \"}\"", first.pos))
+			}
+			return statements, tokens, nil
+		case first.text == "{" || first.quoted:
+			return nil, nil, errors.New(fmt.Sprintf("%s: unexpected %q, expected command", first.pos, first.text))
+		}
+
+		statement := Statement{Name: first.text, Pos: first.pos}
+		tokens = tokens[1:]
+		for len(tokens) > 0 && !tokens[0].isTerminator() && (tokens[0].quoted || tokens[0].text != "{" && tokens[0].text != "}") {
+			statement.Args = append(statement.Args, tokens[0].text)
+			tokens = tokens[1:]
+		}
+
+		if statement.Name == "repeat" || statement.Name == "while" {
+			if len(tokens) == 0 || tokens[0].text != "{" {
+				return nil, nil, errors.New(fmt.Sprintf("%s: missing { after %s", first.pos, statement.Name))
+			}
+			body, rest, err := parseStatements(tokens[1:], true)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(rest) == 0 {
+				return nil, nil, errors.New(fmt.Sprintf("%s: missing } of %s", first.pos, statement.Name))
+			}
+			statement.Body = body
+			tokens = rest[1:]
+		} else if len(tokens) > 0 && !tokens[0].isTerminator() && tokens[0].text != "}" {
+			return nil, nil, errors.New(fmt.Sprintf("%s: unexpected %q in %s", tokens[0].pos, tokens[0].text, statement.Name))
+		}
+
+		if err := validateStatement(statement); err != nil {
+			return nil, nil, err
+		}
+		statements = append(statements, statement)
+	}
+	if inBlock {
+		return nil, nil, nil
+	}
+	return statements, nil, nil
+}
+
+// validateStatement checks the number of arguments of statement.
+func validateStatement(statement Statement) error {
+	wanted := -1
+	switch statement.Name {
+	case "load", "output-file", "compare-to", "echo":
+		wanted = 1
+	case "set":
+		wanted = 2
+	case "while":
+		wanted = 3
+	case "ticktock", "tick", "tock", "output", "clear-echo":
+		wanted = 0
+	case "output-list":
+		if len(statement.Args) == 0 {
+			return errors.New(fmt.Sprintf("%s: output-list needs variables", statement.Pos))
+		}
+	case "repeat":
+		if len(statement.Args) > 1 {
+			return errors.New(fmt.Sprintf("%s: repeat needs a count or nothing", statement.Pos))
+		}
+		if len(statement.Args) == 1 {
+			if count, err := strconv.Atoi(statement.Args[0]); err != nil || count < 0 {
+				return errors.New(fmt.Sprintf("%s: invalid repeat count %q", statement.Pos, statement.Args[0]))
+			}
+		}
+	default:
+		return errors.New(fmt.Sprintf("%s: unknown command %q", statement.Pos, statement.Name))
+	}
+	if wanted >= 0 && len(statement.Args) != wanted {
+		return errors.New(fmt.Sprintf("%s: %s needs %d arguments, got %d", statement.Pos, statement.Name, wanted, len(statement.Args)))
+	}
+	return nil
+}
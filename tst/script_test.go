@@ -0,0 +1,71 @@
+package tst
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fidemin/hack-assembler/assembler"
+)
+
+func TestParseScript(t *testing.T) {
+	source := `load Max.asm, // comment
+output-list RAM[0]%D2.6.2 /* comment
+*/ RAM[1]%D2.6.2;
+echo "Max test";
+repeat 2 {
+  ticktock;
+}
+while RAM[0] <> 0 { set RAM[0] 0; }
+output;`
+	statements, err := ParseScript(strings.NewReader(source), "Max.tst")
+	if err != nil {
+		t.Fatalf("ParseScript() results in error: %s", err)
+	}
+
+	pos := func(line, column int) assembler.Position {
+		return assembler.Position{File: "Max.tst", Line: line, Column: column}
+	}
+	wanted := []Statement{
+		{Name: "load", Args: []string{"Max.asm"}, Pos: pos(1, 1)},
+		{Name: "output-list", Args: []string{"RAM[0]%D2.6.2", "RAM[1]%D2.6.2"}, Pos: pos(2, 1)},
+		{Name: "echo", Args: []string{"Max test"}, Pos: pos(4, 1)},
+		{Name: "repeat", Args: []string{"2"}, Pos: pos(5, 1), Body: []Statement{
+			{Name: "ticktock", Pos: pos(6, 3)},
+		}},
+		{Name: "while", Args: []string{"RAM[0]", "<>", "0"}, Pos: pos(8, 1), Body: []Statement{
+			{Name: "set", Args: []string{"RAM[0]", "0"}, Pos: pos(8, 21)},
+		}},
+		{Name: "output", Pos: pos(9, 1)},
+	}
+	if !reflect.DeepEqual(statements, wanted) {
+		t.Errorf("ParseScript() =\n%+v\nwant\n%+v", statements, wanted)
+	}
+}
+
+func TestParseScript_error(t *testing.T) {
+	tests := []struct {
+		source string
+		wanted string
+	}{
+		{source: "load;", wanted: "Foo.tst:1:1: load needs 1 arguments, got 0"},
+		{source: "\nfoo 1;", wanted: "Foo.tst:2:1: unknown command \"foo\""},
+		{source: "repeat 3 ticktock;", wanted: "Foo.tst:1:1: missing { after repeat"},
+		{source: "repeat -1 { ticktock; }", wanted: "Foo.tst:1:1: invalid repeat count \"-1\""},
+		{source: "repeat { ticktock;", wanted: "Foo.tst:1:1: missing } of repeat"},
+		{source: "ticktock; }", wanted: "Foo.tst:1:11: unexpected \"}\""},
+		{source: "echo \"text", wanted: "Foo.tst:1:6: unterminated string"},
+		{source: "/* comment", wanted: "Foo.tst:1:1: unterminated comment"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseScript(strings.NewReader(test.source), "Foo.tst")
+		if err == nil {
+			t.Errorf("ParseScript(%q) should return error", test.source)
+			continue
+		}
+		if err.Error() != test.wanted {
+			t.Errorf("ParseScript(%q) error = %q, want %q", test.source, err, test.wanted)
+		}
+	}
+}